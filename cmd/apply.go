@@ -0,0 +1,370 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "apply",
+	Short:  "Apply a manifest with many environments",
+	Long: `Use this command to create or reconcile every environment described in a YAML or JSON manifest
+
+Example of manifest:
+organization: myorg
+project: myproject
+environments:
+- name: new-test-environment
+  serviceAccount: new-test-namespace/test-sa
+  serviceConnection: new-test-service-connection
+  namespaceLabels:
+    label1: value1
+  tokenMode: tokenrequest
+  tokenTTL: 720h
+  role: deployer
+  authorizePipelines: all
+  approvers:
+  - user@example.com
+  businessHours:
+    hours: 08:00-18:00
+    timeZone: UTC
+  environmentRoles:
+    admins:
+    - "[myproject]\\Release Managers"
+  serviceConnectionRoles:
+    users:
+    - user@example.com
+  shareWithProjects:
+  - otherproject
+- name: aks-environment
+  serviceAccount: aks-namespace/deployer
+  serviceConnection: aks-service-connection
+  authType: workload-identity
+  workloadIdentity:
+    tenantId: 00000000-0000-0000-0000-000000000000
+    clientId: 00000000-0000-0000-0000-000000000000
+    clusterId: /subscriptions/<id>/resourcegroups/<group>/providers/Microsoft.ContainerService/managedClusters/<name>
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename, err := cmd.Flags().GetString("filename")
+		if err != nil {
+			return err
+		}
+
+		patStdin, err := cmd.Flags().GetBool("pat-stdin")
+		if err != nil {
+			return err
+		}
+
+		if filename == "-" && patStdin {
+			return fmt.Errorf("can't read both manifest and PAT from stdin")
+		}
+
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		noRollback, err := cmd.Flags().GetBool("no-rollback")
+		if err != nil {
+			return err
+		}
+
+		manifest, err := readManifest(filename)
+		if err != nil {
+			return err
+		}
+
+		kubernetes, err := getKubernetes(cmd)
+		if err != nil {
+			return err
+		}
+
+		err = applyManifest(cmd.Context(), azDevOpsSettings, kubernetes, manifest, dryRun, noRollback)
+		if err != nil {
+			cmd.SilenceUsage = true
+		}
+
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringP("filename", "f", "", "[required] Manifest file (YAML or JSON) with the environments. Use - to read from stdin")
+	err := applyCmd.MarkFlagRequired("filename")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addAzDevOpsFlags(applyCmd.Flags())
+	applyCmd.Flags().Bool("dry-run", false, "[default=false] Only look up the existing resources and print what would be created")
+	applyCmd.Flags().Bool("no-rollback", false, "[default=false] Keep the resources created for an environment when it fails, instead of removing them")
+}
+
+// Manifest describes many environments of one Azure DevOps project
+type Manifest struct {
+	Organization string                `json:"organization"`
+	Project      string                `json:"project"`
+	Environments []ManifestEnvironment `json:"environments"`
+}
+
+// ManifestEnvironment describes a single Kubernetes environment
+type ManifestEnvironment struct {
+	Name                   string                    `json:"name"`
+	ServiceAccount         string                    `json:"serviceAccount"`
+	ServiceConnection      string                    `json:"serviceConnection"`
+	NamespaceLabels        map[string]string         `json:"namespaceLabels,omitempty"`
+	TokenMode              string                    `json:"tokenMode,omitempty"`
+	TokenTTL               string                    `json:"tokenTTL,omitempty"`
+	Role                   string                    `json:"role,omitempty"`
+	AuthType               string                    `json:"authType,omitempty"`
+	AcceptUntrustedCerts   bool                      `json:"acceptUntrustedCerts,omitempty"`
+	WorkloadIdentity       *ManifestWorkloadIdentity `json:"workloadIdentity,omitempty"`
+	AuthorizePipelines     string                    `json:"authorizePipelines,omitempty"`
+	Approvers              []string                  `json:"approvers,omitempty"`
+	BusinessHours          *ManifestBusinessHours    `json:"businessHours,omitempty"`
+	EnvironmentRoles       *ManifestRoles            `json:"environmentRoles,omitempty"`
+	ServiceConnectionRoles *ManifestRoles            `json:"serviceConnectionRoles,omitempty"`
+	ShareWithProjects      []string                  `json:"shareWithProjects,omitempty"`
+}
+
+// ManifestRoles lists the identities of each security role
+type ManifestRoles struct {
+	Admins  []string `json:"admins,omitempty"`
+	Users   []string `json:"users,omitempty"`
+	Readers []string `json:"readers,omitempty"`
+}
+
+func (r *ManifestRoles) securityRoles() securityRoles {
+	roles := securityRoles{}
+	if r == nil {
+		return roles
+	}
+
+	for role, identities := range map[string][]string{
+		services.SECURITY_ROLE_ADMINISTRATOR: r.Admins,
+		services.SECURITY_ROLE_USER:          r.Users,
+		services.SECURITY_ROLE_READER:        r.Readers,
+	} {
+		if len(identities) > 0 {
+			roles[role] = identities
+		}
+	}
+
+	return roles
+}
+
+// ManifestBusinessHours is the business hours check of the environment
+type ManifestBusinessHours struct {
+	Hours    string   `json:"hours"`
+	Days     []string `json:"days,omitempty"`
+	TimeZone string   `json:"timeZone,omitempty"`
+}
+
+// ManifestWorkloadIdentity is the federation used by auth type workload-identity
+type ManifestWorkloadIdentity struct {
+	TenantId         string `json:"tenantId"`
+	ClientId         string `json:"clientId"`
+	ClusterId        string `json:"clusterId"`
+	SubscriptionName string `json:"subscriptionName,omitempty"`
+}
+
+// pipelineOptions validates and returns the pipeline settings of the environment
+func (e ManifestEnvironment) pipelineOptions() (*pipelineOptions, error) {
+	var hours, timeZone string
+	var days []string
+	if e.BusinessHours != nil {
+		hours, days, timeZone = e.BusinessHours.Hours, e.BusinessHours.Days, e.BusinessHours.TimeZone
+		if hours == "" {
+			return nil, fmt.Errorf("businessHours requires hours")
+		}
+
+		if timeZone == "" {
+			timeZone = "UTC"
+		}
+	}
+
+	return newPipelineOptions(e.AuthorizePipelines, e.Approvers, hours, days, timeZone)
+}
+
+func readManifest(filename string) (*Manifest, error) {
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %w", filename, err)
+	}
+
+	var manifest Manifest
+	err = yaml.UnmarshalStrict(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %w", filename, err)
+	}
+
+	if manifest.Organization == "" || manifest.Project == "" {
+		return nil, fmt.Errorf("manifest %s must have organization and project", filename)
+	}
+
+	for i, environment := range manifest.Environments {
+		if environment.Name == "" || environment.ServiceAccount == "" || environment.ServiceConnection == "" {
+			return nil, fmt.Errorf("manifest %s: environment #%d must have name, serviceAccount and serviceConnection", filename, i+1)
+		}
+
+		if environment.TokenMode == "" {
+			manifest.Environments[i].TokenMode = tokenModeSecret
+		}
+
+		err = validateTokenMode(manifest.Environments[i].TokenMode)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: environment %s: %w", filename, environment.Name, err)
+		}
+
+		switch environment.AuthType {
+		case "":
+			manifest.Environments[i].AuthType = authTypeKubeconfig
+		case authTypeKubeconfig, authTypeServiceAccount:
+		case authTypeWorkloadIdentity:
+			wif := environment.WorkloadIdentity
+			if wif == nil || wif.TenantId == "" || wif.ClientId == "" || wif.ClusterId == "" {
+				return nil, fmt.Errorf("manifest %s: environment %s: authType %s requires workloadIdentity with tenantId, clientId and clusterId", filename, environment.Name, authTypeWorkloadIdentity)
+			}
+		default:
+			return nil, fmt.Errorf("manifest %s: environment %s: invalid authType %s, please use %s, %s or %s", filename, environment.Name, environment.AuthType, authTypeKubeconfig, authTypeServiceAccount, authTypeWorkloadIdentity)
+		}
+
+		_, err = environment.pipelineOptions()
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: environment %s: %w", filename, environment.Name, err)
+		}
+
+		if environment.TokenTTL != "" {
+			_, err = time.ParseDuration(environment.TokenTTL)
+			if err != nil {
+				return nil, fmt.Errorf("manifest %s: environment %s: invalid tokenTTL: %w", filename, environment.Name, err)
+			}
+		}
+	}
+
+	return &manifest, nil
+}
+
+// applyManifest reconciles every environment, continuing past individual failures
+func applyManifest(ctx context.Context, azDevOpsSettings *azDevOpsSettings, kubernetes *services.Kubernetes, manifest *Manifest, dryRun, noRollback bool) error {
+	type applyResult struct {
+		name   string
+		result string
+		err    error
+	}
+
+	results := make([]applyResult, 0, len(manifest.Environments))
+	failures := 0
+	pending := 0
+	for _, environment := range manifest.Environments {
+		if ctx.Err() != nil {
+			results = append(results, applyResult{name: environment.Name, result: "skipped", err: ctx.Err()})
+			failures++
+			continue
+		}
+
+		logger.Printf("Applying environment %s\n", environment.Name)
+
+		tokenTTL := defaultTokenTTL
+		if environment.TokenTTL != "" {
+			tokenTTL, _ = time.ParseDuration(environment.TokenTTL)
+		}
+
+		var workloadIdentity *services.WorkloadIdentityFederation
+		if environment.WorkloadIdentity != nil {
+			workloadIdentity = &services.WorkloadIdentityFederation{
+				TenantId:           environment.WorkloadIdentity.TenantId,
+				ServicePrincipalId: environment.WorkloadIdentity.ClientId,
+				SubscriptionName:   environment.WorkloadIdentity.SubscriptionName,
+				ClusterId:          environment.WorkloadIdentity.ClusterId,
+			}
+		}
+
+		pipelines, _ := environment.pipelineOptions()
+		err := createKubernetes(ctx, createKubernetesOptions{
+			azDevOps: azDevOpsSettings,
+			targets: []kubernetesTarget{{
+				kubernetes:            kubernetes,
+				serviceConnectionName: environment.ServiceConnection,
+			}},
+			organizationProject:  manifest.Organization + "/" + manifest.Project,
+			environmentName:      environment.Name,
+			serviceAccount:       environment.ServiceAccount,
+			namespaceLabels:      environment.NamespaceLabels,
+			dryRun:               dryRun,
+			noRollback:           noRollback,
+			tokenMode:            environment.TokenMode,
+			tokenTTL:             tokenTTL,
+			role:                 environment.Role,
+			authType:             environment.AuthType,
+			acceptUntrustedCerts: environment.AcceptUntrustedCerts,
+			workloadIdentity:     workloadIdentity,
+			pipelines:            pipelines,
+			security: &securityOptions{
+				environment:       environment.EnvironmentRoles.securityRoles(),
+				serviceConnection: environment.ServiceConnectionRoles.securityRoles(),
+			},
+			shareWithProjects: environment.ShareWithProjects,
+		})
+
+		result := "ok"
+		if _, ok := err.(*pendingChangesError); ok {
+			result = "pending"
+			pending++
+		} else if err != nil {
+			result = "failed"
+			failures++
+			logger.Printf("Error applying environment %s: %v\n", environment.Name, err)
+		}
+
+		results = append(results, applyResult{name: environment.Name, result: result, err: err})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tRESULT\tERROR")
+	for _, r := range results {
+		message := ""
+		if r.err != nil {
+			message = r.err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.name, r.result, message)
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d environments failed", failures, len(manifest.Environments))
+	}
+
+	if pending > 0 {
+		return &pendingChangesError{changes: pending}
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// azDevOpsSettings holds how to reach Azure DevOps, shared by every organization
+type azDevOpsSettings struct {
+	authenticator services.Authenticator
+	baseURL       string
+	apiVersions   map[string]string
+	client        *resty.Client
+}
+
+const (
+	envAzureDevOpsExtPat = "AZURE_DEVOPS_EXT_PAT"
+	envAzenvPat          = "AZENV_PAT"
+	envAzenvAccessToken  = "AZENV_ACCESS_TOKEN"
+	envSystemAccessToken = "SYSTEM_ACCESSTOKEN"
+	envAzureClientID     = "AZURE_CLIENT_ID"
+	envAzureClientSecret = "AZURE_CLIENT_SECRET"
+	envAzureTenantID     = "AZURE_TENANT_ID"
+
+	authModePat               = "pat"
+	authModeBearer            = "bearer"
+	authModeClientCredentials = "client-credentials"
+)
+
+func addAzDevOpsFlags(flags *pflag.FlagSet) {
+	flags.String("pat", "", "AzureDevOps Personal Access Token (PAT). Falls back to "+envAzureDevOpsExtPat+" or "+envAzenvPat+" environment variables")
+	flags.String("pat-file", "", "[default=] Read the AzureDevOps PAT from this file")
+	flags.Bool("pat-stdin", false, "[default=false] Read the AzureDevOps PAT from stdin")
+	flags.String("auth-mode", authModePat, "[default=pat] How to authenticate against AzureDevOps: pat, bearer (access token) or client-credentials (Entra ID service principal)")
+	flags.String("access-token", "", "[default=] Access token for auth-mode bearer. Falls back to "+envAzenvAccessToken+" or "+envSystemAccessToken+" environment variables")
+	flags.String("client-id", "", "[default=] Service principal client id for auth-mode client-credentials. Falls back to "+envAzureClientID+" environment variable")
+	flags.String("client-secret", "", "[default=] Service principal client secret for auth-mode client-credentials. Falls back to "+envAzureClientSecret+" environment variable")
+	flags.String("tenant-id", "", "[default=] Entra ID tenant for auth-mode client-credentials. Falls back to "+envAzureTenantID+" environment variable")
+	flags.String("token-url", services.AZURE_AD_TOKEN_URL, "[default=https://login.microsoftonline.com/{tenant}/oauth2/v2.0/token] Token endpoint for auth-mode client-credentials. {tenant} is replaced by tenant-id")
+	flags.String("azdevops-url", services.AZUREDEVOPS_DEFAULT_BASE_URL, "[default=https://dev.azure.com/{organization}] AzureDevOps organization URL. For Azure DevOps Server use the collection URL (ex: https://tfs.example.com/tfs/{organization})")
+	flags.Int("max-retries", services.DEFAULT_MAX_RETRIES, "[default=3] How many times a failed AzureDevOps request is retried. Throttled requests and server errors of idempotent requests are retried with exponential backoff, 0 disables retries")
+	flags.Duration("request-timeout", services.DEFAULT_REQUEST_TIMEOUT, "[default=60s] Timeout of each AzureDevOps request attempt, 0 means no timeout")
+	flags.StringSlice("azdevops-api-version", nil, "[default=] Override the api-version of an API area (ex: environments=6.0-preview.1). Areas: environments, serviceendpoints, projects, pipelines, identities and securityroles")
+}
+
+func getAzDevOpsSettings(cmd *cobra.Command) (*azDevOpsSettings, error) {
+	baseURL, err := cmd.Flags().GetString("azdevops-url")
+	if err != nil {
+		return nil, err
+	}
+
+	apiVersions, err := cmd.Flags().GetStringSlice("azdevops-api-version")
+	if err != nil {
+		return nil, err
+	}
+
+	apiVersionMap, err := stringArrayToMap(apiVersions)
+	if err != nil {
+		return nil, fmt.Errorf("error processing specified api versions: %w", err)
+	}
+
+	for area := range apiVersionMap {
+		if _, ok := services.DefaultAPIVersions[area]; !ok {
+			return nil, fmt.Errorf("unknown AzureDevOps API area %s", area)
+		}
+	}
+
+	maxRetries, err := cmd.Flags().GetInt("max-retries")
+	if err != nil {
+		return nil, err
+	}
+
+	if maxRetries < 0 {
+		return nil, fmt.Errorf("invalid max-retries %d, it can't be negative", maxRetries)
+	}
+
+	requestTimeout, err := cmd.Flags().GetDuration("request-timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	client := services.NewClient(services.RetryOptions{
+		MaxRetries:     maxRetries,
+		RequestTimeout: requestTimeout,
+		OnRetry: func(method, url string, attempt int, reason string) {
+			logger.Printf("Retrying %s %s (attempt %d failed: %s)\n", method, url, attempt, reason)
+		},
+	})
+
+	// the authenticator shares the client, so token requests are retried and
+	// timed out like any other
+	authenticator, err := resolveAuthenticator(cmd, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azDevOpsSettings{
+		authenticator: authenticator,
+		baseURL:       baseURL,
+		apiVersions:   apiVersionMap,
+		client:        client,
+	}, nil
+}
+
+// newAzDevOps creates the Azure DevOps service for the organization
+func (s *azDevOpsSettings) newAzDevOps(organization string) *services.AzDevOps {
+	return &services.AzDevOps{
+		Organization:  organization,
+		Authenticator: s.authenticator,
+		BaseURL:       s.baseURL,
+		APIVersions:   s.apiVersions,
+		Client:        s.client,
+	}
+}
+
+// resolveAuthenticator creates the authenticator selected by --auth-mode
+func resolveAuthenticator(cmd *cobra.Command, client *resty.Client) (services.Authenticator, error) {
+	authMode, err := cmd.Flags().GetString("auth-mode")
+	if err != nil {
+		return nil, err
+	}
+
+	switch authMode {
+	case authModePat:
+		pat, err := resolvePat(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		return &services.PatAuthenticator{Pat: pat}, nil
+	case authModeBearer:
+		accessToken, err := getFlagOrEnv(cmd, "access-token", envAzenvAccessToken, envSystemAccessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		return &services.BearerTokenAuthenticator{Token: accessToken}, nil
+	case authModeClientCredentials:
+		clientID, err := getFlagOrEnv(cmd, "client-id", envAzureClientID)
+		if err != nil {
+			return nil, err
+		}
+
+		clientSecret, err := getFlagOrEnv(cmd, "client-secret", envAzureClientSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		tokenURL, err := cmd.Flags().GetString("token-url")
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(tokenURL, "{tenant}") {
+			tenantID, err := getFlagOrEnv(cmd, "tenant-id", envAzureTenantID)
+			if err != nil {
+				return nil, err
+			}
+
+			tokenURL = strings.ReplaceAll(tokenURL, "{tenant}", url.PathEscape(tenantID))
+		}
+
+		return &services.ClientCredentialsAuthenticator{
+			TokenURL:     tokenURL,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scope:        services.AZUREDEVOPS_OAUTH_SCOPE,
+			Client:       client,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid auth-mode %s, please use %s, %s or %s", authMode, authModePat, authModeBearer, authModeClientCredentials)
+}
+
+// getFlagOrEnv returns the flag value or the first environment variable set
+func getFlagOrEnv(cmd *cobra.Command, flag string, envs ...string) (string, error) {
+	value, err := cmd.Flags().GetString(flag)
+	if err != nil {
+		return "", err
+	}
+
+	if value != "" {
+		return value, nil
+	}
+
+	for _, env := range envs {
+		if value = os.Getenv(env); value != "" {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("--%s is required, it can also be set with %s environment variable", flag, strings.Join(envs, " or "))
+}
+
+// resolvePat looks for the PAT in --pat, --pat-file, --pat-stdin and then in
+// the environment variables, returning the first one found
+func resolvePat(cmd *cobra.Command) (string, error) {
+	pat, err := cmd.Flags().GetString("pat")
+	if err != nil {
+		return "", err
+	}
+
+	if pat != "" {
+		return pat, nil
+	}
+
+	patFile, err := cmd.Flags().GetString("pat-file")
+	if err != nil {
+		return "", err
+	}
+
+	if patFile != "" {
+		data, err := os.ReadFile(patFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading PAT file %s: %w", patFile, err)
+		}
+
+		pat = strings.TrimSpace(string(data))
+		if pat == "" {
+			return "", fmt.Errorf("PAT file %s is empty", patFile)
+		}
+
+		return pat, nil
+	}
+
+	patStdin, err := cmd.Flags().GetBool("pat-stdin")
+	if err != nil {
+		return "", err
+	}
+
+	if patStdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("error reading PAT from stdin: %w", err)
+		}
+
+		pat = strings.TrimSpace(string(data))
+		if pat == "" {
+			return "", fmt.Errorf("no PAT found in stdin")
+		}
+
+		return pat, nil
+	}
+
+	for _, env := range []string{envAzureDevOpsExtPat, envAzenvPat} {
+		if pat = os.Getenv(env); pat != "" {
+			return pat, nil
+		}
+	}
+
+	return "", fmt.Errorf("AzureDevOps PAT not found, please use --pat, --pat-file, --pat-stdin or the %s/%s environment variables", envAzureDevOpsExtPat, envAzenvPat)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+)
+
+// getKubernetes resolves the kubernetes cluster of the global kubeconfig flags
+func getKubernetes(cmd *cobra.Command) (*services.Kubernetes, error) {
+	kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return nil, err
+	}
+
+	context, err := cmd.Flags().GetString("context")
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := cmd.Flags().GetString("cluster-server")
+	if err != nil {
+		return nil, err
+	}
+
+	return services.NewKubernetes(kubeconfig, context, server)
+}
+
+// kubernetesTarget is a cluster provisioned inside an environment
+type kubernetesTarget struct {
+	// context is the kubeconfig context, empty for the cluster of the global flags
+	context               string
+	kubernetes            *services.Kubernetes
+	serviceConnectionName string
+}
+
+// displayName prefixes the name with the context when there are many clusters
+func (t kubernetesTarget) displayName(name string) string {
+	if t.context == "" {
+		return name
+	}
+
+	return t.context + ":" + name
+}
+
+// getKubernetesTargets reads the repeated --cluster entries or, without them,
+// the single cluster of the global flags with --service-connection
+func getKubernetesTargets(cmd *cobra.Command) ([]kubernetesTarget, error) {
+	clusters, err := cmd.Flags().GetStringArray("cluster")
+	if err != nil {
+		return nil, err
+	}
+
+	serviceConnection, err := cmd.Flags().GetString("service-connection")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clusters) == 0 {
+		if serviceConnection == "" {
+			return nil, fmt.Errorf("--service-connection or --cluster is required")
+		}
+
+		kubernetes, err := getKubernetes(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		return []kubernetesTarget{{
+			kubernetes:            kubernetes,
+			serviceConnectionName: serviceConnection,
+		}}, nil
+	}
+
+	if serviceConnection != "" {
+		return nil, fmt.Errorf("--service-connection can't be used with --cluster, set serviceConnection inside each --cluster")
+	}
+
+	server, err := cmd.Flags().GetString("cluster-server")
+	if err != nil {
+		return nil, err
+	}
+
+	if server != "" {
+		return nil, fmt.Errorf("--cluster-server can't be used with --cluster")
+	}
+
+	kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]kubernetesTarget, 0, len(clusters))
+	seen := map[string]bool{}
+	for _, cluster := range clusters {
+		fields, err := stringArrayToMap(strings.Split(cluster, ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --cluster %s: %w", cluster, err)
+		}
+
+		for key := range fields {
+			if key != "context" && key != "serviceConnection" {
+				return nil, fmt.Errorf("invalid --cluster %s: unknown field %s, please use context and serviceConnection", cluster, key)
+			}
+		}
+
+		context, serviceConnectionName := fields["context"], fields["serviceConnection"]
+		if context == "" || serviceConnectionName == "" {
+			return nil, fmt.Errorf("invalid --cluster %s: context and serviceConnection are required", cluster)
+		}
+
+		if seen["context="+context] || seen["serviceConnection="+serviceConnectionName] {
+			return nil, fmt.Errorf("invalid --cluster %s: context and serviceConnection must be unique", cluster)
+		}
+		seen["context="+context] = true
+		seen["serviceConnection="+serviceConnectionName] = true
+
+		kubernetes, err := services.NewKubernetes(kubeconfig, context, "")
+		if err != nil {
+			return nil, fmt.Errorf("error loading cluster %s: %w", context, err)
+		}
+
+		targets = append(targets, kubernetesTarget{
+			context:               context,
+			kubernetes:            kubernetes,
+			serviceConnectionName: serviceConnectionName,
+		})
+	}
+
+	return targets, nil
+}
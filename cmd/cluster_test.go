@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: user
+- name: prod
+  context:
+    cluster: prod
+    user: user
+users:
+- name: user
+  user:
+    token: token
+`
+
+// newTestClusterCommand parses the args with the cluster flags of create kubernetes
+func newTestClusterCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("kubeconfig", kubeconfig, "")
+	cmd.Flags().String("context", "", "")
+	cmd.Flags().String("cluster-server", "", "")
+	cmd.Flags().String("service-connection", "", "")
+	cmd.Flags().StringArray("cluster", nil, "")
+
+	err = cmd.ParseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd
+}
+
+func TestGetKubernetesTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// want lists the targets as context/serviceConnection/server
+		want    []string
+		wantErr string
+	}{
+		{name: "no cluster", args: nil, wantErr: "--service-connection or --cluster is required"},
+		{name: "global flags", args: []string{"--service-connection", "sc"}, want: []string{"/sc/https://dev.example.com"}},
+		{name: "global flags with context", args: []string{"--service-connection", "sc", "--context", "prod"}, want: []string{"/sc/https://prod.example.com"}},
+		{name: "global flags with server", args: []string{"--service-connection", "sc", "--cluster-server", "https://api.example.com"}, want: []string{"/sc/https://api.example.com"}},
+		{
+			name: "clusters",
+			args: []string{"--cluster", "context=dev,serviceConnection=sc-dev", "--cluster", "serviceConnection=sc-prod,context=prod"},
+			want: []string{"dev/sc-dev/https://dev.example.com", "prod/sc-prod/https://prod.example.com"},
+		},
+		{name: "cluster with service connection", args: []string{"--service-connection", "sc", "--cluster", "context=dev,serviceConnection=sc-dev"}, wantErr: "--service-connection can't be used with --cluster"},
+		{name: "cluster with server", args: []string{"--cluster-server", "https://api.example.com", "--cluster", "context=dev,serviceConnection=sc-dev"}, wantErr: "--cluster-server can't be used with --cluster"},
+		{name: "invalid format", args: []string{"--cluster", "dev"}, wantErr: "key=value"},
+		{name: "unknown field", args: []string{"--cluster", "context=dev,serviceConnection=sc-dev,namespace=ns"}, wantErr: "unknown field namespace"},
+		{name: "missing service connection", args: []string{"--cluster", "context=dev"}, wantErr: "context and serviceConnection are required"},
+		{name: "empty context", args: []string{"--cluster", "context=,serviceConnection=sc-dev"}, wantErr: "context and serviceConnection are required"},
+		{name: "repeated context", args: []string{"--cluster", "context=dev,serviceConnection=sc-dev", "--cluster", "context=dev,serviceConnection=sc-prod"}, wantErr: "must be unique"},
+		{name: "repeated service connection", args: []string{"--cluster", "context=dev,serviceConnection=sc", "--cluster", "context=prod,serviceConnection=sc"}, wantErr: "must be unique"},
+		{name: "unknown context", args: []string{"--cluster", "context=test,serviceConnection=sc-test"}, wantErr: "error loading cluster test"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets, err := getKubernetesTargets(newTestClusterCommand(t, test.args...))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, target := range targets {
+				got = append(got, target.context+"/"+target.serviceConnectionName+"/"+target.kubernetes.Config.Host)
+			}
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got targets %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesTargetDisplayName(t *testing.T) {
+	if name := (kubernetesTarget{}).displayName("sa"); name != "sa" {
+		t.Errorf("got %q without context, want %q", name, "sa")
+	}
+
+	if name := (kubernetesTarget{context: "prod"}).displayName("sa"); name != "prod:sa" {
+		t.Errorf("got %q with context, want %q", name, "prod:sa")
+	}
+}
@@ -18,14 +18,8 @@ var createCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(createCmd)
 
-	createCmd.PersistentFlags().String("pat", "", "[required] AzureDevOps Personal Access Token (PAT)")
-	err := createCmd.MarkPersistentFlagRequired("pat")
-	if err != nil {
-		logger.Println(err.Error())
-	}
-
 	createCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
-	err = createCmd.MarkPersistentFlagRequired("project")
+	err := createCmd.MarkPersistentFlagRequired("project")
 	if err != nil {
 		logger.Println(err.Error())
 	}
@@ -36,9 +30,7 @@ func init() {
 		logger.Println(err.Error())
 	}
 
-	createCmd.PersistentFlags().StringP("service-connection", "c", "", "[required] AzureDevOps service connection name")
-	err = createCmd.MarkPersistentFlagRequired("service-connection")
-	if err != nil {
-		logger.Println(err.Error())
-	}
+	createCmd.PersistentFlags().StringP("service-connection", "c", "", "[required unless --cluster is used] AzureDevOps service connection name")
+
+	addAzDevOpsFlags(createCmd.PersistentFlags())
 }
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "delete",
+	Short:  "Delete an environment",
+	Long:   `Use this command to delete an AzureDevOps Environment and the resources created for it`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Println("Error: must also specify a resource like kubernetes")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
+	err := deleteCmd.MarkPersistentFlagRequired("project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	deleteCmd.PersistentFlags().StringP("name", "n", "", "[required] AzureDevOps environment name")
+	err = deleteCmd.MarkPersistentFlagRequired("name")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	deleteCmd.PersistentFlags().StringP("service-connection", "c", "", "[required] AzureDevOps service connection name")
+	err = deleteCmd.MarkPersistentFlagRequired("service-connection")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addAzDevOpsFlags(deleteCmd.PersistentFlags())
+}
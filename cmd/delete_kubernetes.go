@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+)
+
+// deleteKubernetesCmd represents the delete kubernetes command
+var deleteKubernetesCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "kubernetes",
+	Short:  "Delete a Kubernetes environment",
+	Long:   `Use this command to delete an AzureDevOps Kubernetes Environment and the resources created by "create kubernetes"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return err
+		}
+
+		serviceConnection, err := cmd.Flags().GetString("service-connection")
+		if err != nil {
+			return err
+		}
+
+		serviceAccount, err := cmd.Flags().GetString("service-account")
+		if err != nil {
+			return err
+		}
+
+		keepNamespace, err := cmd.Flags().GetBool("keep-namespace")
+		if err != nil {
+			return err
+		}
+
+		keepServiceAccount, err := cmd.Flags().GetBool("keep-service-account")
+		if err != nil {
+			return err
+		}
+
+		keepEnvironment, err := cmd.Flags().GetBool("keep-environment")
+		if err != nil {
+			return err
+		}
+
+		kubernetes, err := getKubernetes(cmd)
+		if err != nil {
+			return err
+		}
+
+		return deleteKubernetes(cmd.Context(), azDevOpsSettings, kubernetes, organizationProject, name, serviceAccount, serviceConnection, keepNamespace, keepServiceAccount, keepEnvironment)
+	},
+}
+
+func init() {
+	deleteCmd.AddCommand(deleteKubernetesCmd)
+
+	deleteKubernetesCmd.Flags().StringP("service-account", "a", "", "[required] Kubernetes service account name with namespace (ex: namespace/service-account-name)")
+	err := deleteKubernetesCmd.MarkFlagRequired("service-account")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	deleteKubernetesCmd.Flags().Bool("keep-namespace", false, "[default=false] Do not delete the Kubernetes namespace")
+	deleteKubernetesCmd.Flags().Bool("keep-service-account", false, "[default=false] Do not delete the Kubernetes service account")
+	deleteKubernetesCmd.Flags().Bool("keep-environment", false, "[default=false] Do not delete the AzureDevOps environment (only its Kubernetes resource)")
+}
+
+func deleteKubernetes(ctx context.Context, azDevOpsSettings *azDevOpsSettings, kubernetes *services.Kubernetes, azDevOpsOrgProjectName, environmentName, namespaceServiceAccountName, serviceConnectionName string, keepNamespace, keepServiceAccount, keepEnvironment bool) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	namespaceName, serviceAccountName, err := splitNamespaceServiceAccount(namespaceServiceAccountName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+
+	// service endpoint
+	// ----------------
+	serviceConnection, err := azdevOps.FindServiceEndpoint(ctx, azDevOpsProjectName, serviceConnectionName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for service connection %s: %w", serviceConnectionName, err)
+	}
+
+	// environment resource
+	// --------------------
+	azDevOpsEnvironment, err := azdevOps.FindEnvironment(ctx, azDevOpsProjectName, environmentName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for environment %s: %w", environmentName, err)
+	}
+
+	if azDevOpsEnvironment != nil {
+		kubernetesResource, err := findEnvironmentResource(ctx, azdevOps, azDevOpsProjectName, azDevOpsEnvironment.Id, namespaceName, serviceConnection)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error looking for resource %s inside environment %s: %w", namespaceName, environmentName, err)
+		}
+
+		if kubernetesResource != nil {
+			err = azdevOps.DeleteKubernetesResource(ctx, azDevOpsProjectName, azDevOpsEnvironment.Id, kubernetesResource.Id)
+			if err != nil {
+				return fmt.Errorf("error deleting resource %s inside environment %s: %w", namespaceName, environmentName, err)
+			}
+
+			logger.Printf("Deleted resource %s inside environment %s\n", namespaceName, environmentName)
+		} else {
+			logger.Printf("Resource %s inside environment %s not found\n", namespaceName, environmentName)
+		}
+	} else {
+		logger.Printf("Environment %s not found\n", environmentName)
+	}
+
+	// service endpoint deletion, after the resource using it
+	if serviceConnection != nil {
+		project, err := azdevOps.FindProject(ctx, azDevOpsProjectName)
+		if err != nil {
+			return fmt.Errorf("error looking for Azure DevOps project %s: %w", azDevOpsProjectName, err)
+		}
+
+		// a shared service connection is only deleted when removed from every project
+		err = azdevOps.DeleteServiceEndpoint(ctx, serviceConnection.Id, serviceConnection.ProjectIds(project.ID))
+		if err != nil {
+			return fmt.Errorf("error deleting service connection %s: %w", serviceConnectionName, err)
+		}
+
+		logger.Printf("Deleted service connection %s\n", serviceConnectionName)
+	} else {
+		logger.Printf("Service connection %s not found\n", serviceConnectionName)
+	}
+
+	// environment
+	// -----------
+	if azDevOpsEnvironment != nil && !keepEnvironment {
+		// only remove the environment when nothing else is registered inside it
+		environment, err := azdevOps.GetEnvironment(ctx, azDevOpsProjectName, azDevOpsEnvironment.Id)
+		if err != nil {
+			return fmt.Errorf("error looking for environment %s: %w", environmentName, err)
+		}
+
+		if len(environment.Resources) == 0 {
+			err = azdevOps.DeleteEnvironment(ctx, azDevOpsProjectName, azDevOpsEnvironment.Id)
+			if err != nil {
+				return fmt.Errorf("error deleting environment %s: %w", environmentName, err)
+			}
+
+			logger.Printf("Deleted environment %s\n", environmentName)
+		} else {
+			logger.Printf("Environment %s still has %d resources, keeping it\n", environmentName, len(environment.Resources))
+		}
+	}
+
+	// kubernetes
+	// ----------
+	err = deleteServiceAccountRoles(ctx, kubernetes, namespaceName, serviceAccountName)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := serviceAccountTokenSecrets(ctx, kubernetes, namespaceName, serviceAccountName)
+	if err != nil {
+		return err
+	}
+
+	if len(secrets) == 0 {
+		logger.Printf("Kubernetes secret %s/%s not found\n", namespaceName, serviceAccountSecretName(serviceAccountName))
+	}
+
+	for _, secret := range secrets {
+		err = kubernetes.DeleteSecret(ctx, namespaceName, secret.Name)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error deleting secret %s/%s: %w", namespaceName, secret.Name, err)
+		}
+
+		logger.Printf("Kubernetes secret %s/%s deleted\n", namespaceName, secret.Name)
+	}
+
+	if !keepServiceAccount {
+		err = kubernetes.DeleteServiceAccount(ctx, namespaceName, serviceAccountName)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error deleting service account %s/%s: %w", namespaceName, serviceAccountName, err)
+		}
+
+		if err == nil {
+			logger.Printf("Kubernetes service account %s/%s deleted\n", namespaceName, serviceAccountName)
+		} else {
+			logger.Printf("Kubernetes service account %s/%s not found\n", namespaceName, serviceAccountName)
+		}
+	}
+
+	if !keepNamespace {
+		err = kubernetes.DeleteNamespace(ctx, namespaceName)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error deleting namespace %s: %w", namespaceName, err)
+		}
+
+		if err == nil {
+			logger.Printf("Namespace %s deleted\n", namespaceName)
+		} else {
+			logger.Printf("Namespace %s not found\n", namespaceName)
+		}
+	}
+
+	return nil
+}
+
+// findEnvironmentResource looks for the namespace resource using the service
+// connection, since the same namespace can come from many clusters
+func findEnvironmentResource(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, environmentId int, namespaceName string, serviceConnection *services.AzDevopsServiceEndpoint) (*services.AzDevopsKubernetesResource, error) {
+	if serviceConnection == nil {
+		return azdevOps.FindKubernetesResource(ctx, azDevOpsProjectName, environmentId, namespaceName)
+	}
+
+	kubernetesResources, err := azdevOps.ListKubernetesResources(ctx, azDevOpsProjectName, environmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range kubernetesResources {
+		if kubernetesResources[i].Namespace == namespaceName && kubernetesResources[i].ServiceEndpointId == serviceConnection.Id {
+			return &kubernetesResources[i], nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// describeCmd represents the describe command
+var describeCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "describe",
+	Short:  "Describe an environment",
+	Long:   `Use this command to show the details of an AzureDevOps Environment`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Println("Error: must also specify a resource like environment")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+
+	describeCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
+	err := describeCmd.MarkPersistentFlagRequired("project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addOutputFlag(describeCmd.PersistentFlags())
+	addAzDevOpsFlags(describeCmd.PersistentFlags())
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+)
+
+// describeEnvironmentCmd represents the describe environment command
+var describeEnvironmentCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "environment <name>",
+	Short:  "Describe an environment",
+	Long:   `Use this command to show an AzureDevOps Environment with its Kubernetes resources and last deployment`,
+	Args:   cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		output, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		return describeEnvironment(cmd.Context(), azDevOpsSettings, organizationProject, args[0], output)
+	},
+}
+
+func init() {
+	describeCmd.AddCommand(describeEnvironmentCmd)
+}
+
+// environmentDescription is the describe environment output
+type environmentDescription struct {
+	Id             int                              `json:"id"`
+	Name           string                           `json:"name"`
+	Resources      []environmentResourceDescription `json:"resources"`
+	LastDeployment *deploymentDescription           `json:"lastDeployment,omitempty"`
+}
+
+type environmentResourceDescription struct {
+	Id                    int    `json:"id"`
+	Name                  string `json:"name"`
+	Namespace             string `json:"namespace"`
+	Cluster               string `json:"cluster,omitempty"`
+	ServiceConnectionId   string `json:"serviceConnectionId"`
+	ServiceConnectionName string `json:"serviceConnectionName,omitempty"`
+}
+
+type deploymentDescription struct {
+	Pipeline   string     `json:"pipeline"`
+	Run        string     `json:"run"`
+	Stage      string     `json:"stage,omitempty"`
+	Job        string     `json:"job,omitempty"`
+	Result     string     `json:"result,omitempty"`
+	FinishTime *time.Time `json:"finishTime,omitempty"`
+}
+
+func describeEnvironment(ctx context.Context, azDevOpsSettings *azDevOpsSettings, azDevOpsOrgProjectName, environmentName, output string) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+	environment, err := azdevOps.FindEnvironment(ctx, azDevOpsProjectName, environmentName)
+	if err != nil {
+		return fmt.Errorf("error looking for environment %s: %w", environmentName, err)
+	}
+
+	kubernetesResources, err := azdevOps.ListKubernetesResources(ctx, azDevOpsProjectName, environment.Id)
+	if err != nil {
+		return fmt.Errorf("error looking for resources inside environment %s: %w", environmentName, err)
+	}
+
+	serviceConnections, err := azdevOps.ListServiceEndpoints(ctx, azDevOpsProjectName)
+	if err != nil {
+		return fmt.Errorf("error listing service connections: %w", err)
+	}
+
+	serviceConnectionNames := make(map[string]string, len(serviceConnections))
+	for _, serviceConnection := range serviceConnections {
+		serviceConnectionNames[serviceConnection.Id] = serviceConnection.Name
+	}
+
+	description := environmentDescription{
+		Id:        environment.Id,
+		Name:      environment.Name,
+		Resources: make([]environmentResourceDescription, 0, len(kubernetesResources)),
+	}
+
+	for _, resource := range kubernetesResources {
+		description.Resources = append(description.Resources, environmentResourceDescription{
+			Id:                    resource.Id,
+			Name:                  resource.Name,
+			Namespace:             resource.Namespace,
+			Cluster:               resource.ClusterName,
+			ServiceConnectionId:   resource.ServiceEndpointId,
+			ServiceConnectionName: serviceConnectionNames[resource.ServiceEndpointId],
+		})
+	}
+
+	deployment, err := azdevOps.GetLastDeployment(ctx, azDevOpsProjectName, environment.Id)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for deployments of environment %s: %w", environmentName, err)
+	}
+
+	if deployment != nil {
+		description.LastDeployment = &deploymentDescription{
+			Pipeline:   deployment.Definition.Name,
+			Run:        deployment.Owner.Name,
+			Stage:      deployment.StageName,
+			Job:        deployment.JobName,
+			Result:     deployment.Result,
+			FinishTime: deployment.FinishTime,
+		}
+	}
+
+	return printOutput(os.Stdout, output, description, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Id:\t%d\n", description.Id)
+		fmt.Fprintf(w, "Name:\t%s\n", description.Name)
+		if deployment := description.LastDeployment; deployment != nil {
+			finished := "running"
+			if deployment.FinishTime != nil {
+				finished = deployment.FinishTime.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "Last deployment:\t%s #%s, stage %s (%s, %s)\n", deployment.Pipeline, deployment.Run, deployment.Stage, deployment.Result, finished)
+		} else {
+			fmt.Fprintf(w, "Last deployment:\tnone\n")
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "ID\tNAME\tNAMESPACE\tCLUSTER\tSERVICE CONNECTION")
+		for _, resource := range description.Resources {
+			serviceConnection := resource.ServiceConnectionName
+			if serviceConnection == "" {
+				serviceConnection = resource.ServiceConnectionId
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", resource.Id, resource.Name, resource.Namespace, resource.Cluster, serviceConnection)
+		}
+	})
+}
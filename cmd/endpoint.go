@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	authTypeKubeconfig       = "kubeconfig"
+	authTypeServiceAccount   = "service-account"
+	authTypeWorkloadIdentity = "workload-identity"
+)
+
+func addAuthTypeFlags(flags *pflag.FlagSet) {
+	flags.String("auth-type", authTypeKubeconfig, "[default=kubeconfig] Service connection authorization: kubeconfig, service-account (API server URL, token and CA) or workload-identity (AKS with workload identity federation)")
+	flags.String("wif-tenant-id", "", "[default=] Entra ID tenant of the service principal for auth-type workload-identity")
+	flags.String("wif-client-id", "", "[default=] Service principal (app registration) client id for auth-type workload-identity")
+	flags.String("aks-cluster-id", "", "[default=] AKS cluster resource id for auth-type workload-identity (ex: /subscriptions/<id>/resourcegroups/<group>/providers/Microsoft.ContainerService/managedClusters/<name>)")
+	flags.String("azure-subscription-name", "", "[default=subscription id] Azure subscription name for auth-type workload-identity")
+	addAcceptUntrustedCertsFlag(flags)
+}
+
+func addAcceptUntrustedCertsFlag(flags *pflag.FlagSet) {
+	flags.Bool("accept-untrusted-certs", false, "[default=false] Let pipelines skip the TLS verification of the Kubernetes API server")
+}
+
+// getWorkloadIdentityFlags validates the auth type and, for workload-identity,
+// reads the federation flags
+func getWorkloadIdentityFlags(cmd *cobra.Command, authType string) (*services.WorkloadIdentityFederation, error) {
+	switch authType {
+	case authTypeKubeconfig, authTypeServiceAccount:
+		return nil, nil
+	case authTypeWorkloadIdentity:
+	default:
+		return nil, fmt.Errorf("invalid auth-type %s, please use %s, %s or %s", authType, authTypeKubeconfig, authTypeServiceAccount, authTypeWorkloadIdentity)
+	}
+
+	tenantId, err := cmd.Flags().GetString("wif-tenant-id")
+	if err != nil {
+		return nil, err
+	}
+
+	clientId, err := cmd.Flags().GetString("wif-client-id")
+	if err != nil {
+		return nil, err
+	}
+
+	clusterId, err := cmd.Flags().GetString("aks-cluster-id")
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionName, err := cmd.Flags().GetString("azure-subscription-name")
+	if err != nil {
+		return nil, err
+	}
+
+	if tenantId == "" || clientId == "" || clusterId == "" {
+		return nil, fmt.Errorf("auth-type %s requires wif-tenant-id, wif-client-id and aks-cluster-id", authTypeWorkloadIdentity)
+	}
+
+	return &services.WorkloadIdentityFederation{
+		TenantId:           tenantId,
+		ServicePrincipalId: clientId,
+		SubscriptionName:   subscriptionName,
+		ClusterId:          clusterId,
+	}, nil
+}
+
+// newEndpointCredentials builds the service connection credentials with the
+// service account token. TLS verification is only skipped when asked to
+func newEndpointCredentials(kubernetes *services.Kubernetes, authType, namespaceName, serviceAccountName string, token *serviceAccountToken, showKubeconfig, acceptUntrustedCerts bool) (*services.KubernetesEndpointCredentials, error) {
+	cluster, err := kubernetes.GetCluster()
+	if err != nil {
+		return nil, fmt.Errorf("error reading kubernetes cluster information: %w", err)
+	}
+
+	cluster.InsecureSkipTLSVerify = acceptUntrustedCerts
+	if !cluster.InsecureSkipTLSVerify && len(cluster.CertificateAuthorityData) == 0 {
+		// token secrets carry the CA of the cluster
+		cluster.CertificateAuthorityData = token.ca
+		if len(cluster.CertificateAuthorityData) == 0 {
+			return nil, fmt.Errorf("no CA found for cluster %s, please add it to the kubeconfig or use --accept-untrusted-certs", cluster.Server)
+		}
+	}
+
+	if authType == authTypeServiceAccount {
+		return services.NewServiceAccountCredentials(cluster, token.token), nil
+	}
+
+	kubeconfig, err := kubernetes.CreateKubeconfig(cluster, serviceAccountName, namespaceName, token.token)
+	if err != nil {
+		return nil, fmt.Errorf("error generating kubernetes kubeconfig: %w", err)
+	}
+	logger.Printf("Kubernetes kubeconfig created\n")
+
+	if showKubeconfig {
+		logger.Println(kubeconfig)
+	}
+
+	return services.NewKubeconfigCredentials(cluster, kubeconfig), nil
+}
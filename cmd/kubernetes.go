@@ -17,15 +17,16 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ericogr/azenv/services"
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
-
-	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 // kubernetesCmd represents the kubernetes command
@@ -35,7 +36,7 @@ var kubernetesCmd = &cobra.Command{
 	Short:  "Create a new Kubernetes environment",
 	Long:   `Use this command to create a new AzureDevOps Kubernetes Environment`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		pat, err := cmd.Flags().GetString("pat")
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
 		if err != nil {
 			return err
 		}
@@ -50,19 +51,19 @@ var kubernetesCmd = &cobra.Command{
 			return err
 		}
 
-		serviceConnection, err := cmd.Flags().GetString("service-connection")
+		serviceAccount, err := cmd.Flags().GetString("service-account")
 		if err != nil {
 			return err
 		}
 
-		serviceAccount, err := cmd.Flags().GetString("service-account")
+		namespaceLabels, err := cmd.Flags().GetStringSlice("namespace-label")
 		if err != nil {
 			return err
 		}
 
-		namespaceLabels, err := cmd.Flags().GetStringSlice("namespace-label")
+		namespaceLabelMap, err := stringArrayToMap(namespaceLabels)
 		if err != nil {
-			return err
+			return fmt.Errorf("error processing specified labels: %w", err)
 		}
 
 		showKubeconfig, err := cmd.Flags().GetBool("show-kubeconfig")
@@ -70,7 +71,102 @@ var kubernetesCmd = &cobra.Command{
 			return err
 		}
 
-		return createKubernetes(pat, organizationProject, name, serviceAccount, serviceConnection, namespaceLabels, showKubeconfig)
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		tokenMode, err := cmd.Flags().GetString("token-mode")
+		if err != nil {
+			return err
+		}
+
+		err = validateTokenMode(tokenMode)
+		if err != nil {
+			return err
+		}
+
+		tokenTTL, err := cmd.Flags().GetDuration("token-ttl")
+		if err != nil {
+			return err
+		}
+
+		role, err := cmd.Flags().GetString("role")
+		if err != nil {
+			return err
+		}
+
+		authType, err := cmd.Flags().GetString("auth-type")
+		if err != nil {
+			return err
+		}
+
+		workloadIdentity, err := getWorkloadIdentityFlags(cmd, authType)
+		if err != nil {
+			return err
+		}
+
+		acceptUntrustedCerts, err := cmd.Flags().GetBool("accept-untrusted-certs")
+		if err != nil {
+			return err
+		}
+
+		output, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		pipelines, err := getPipelineFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		security, err := getSecurityRoleFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		shareWithProjects, err := cmd.Flags().GetStringArray("share-with-project")
+		if err != nil {
+			return err
+		}
+
+		noRollback, err := cmd.Flags().GetBool("no-rollback")
+		if err != nil {
+			return err
+		}
+
+		targets, err := getKubernetesTargets(cmd)
+		if err != nil {
+			return err
+		}
+
+		err = createKubernetes(cmd.Context(), createKubernetesOptions{
+			azDevOps:             azDevOpsSettings,
+			targets:              targets,
+			organizationProject:  organizationProject,
+			environmentName:      name,
+			serviceAccount:       serviceAccount,
+			namespaceLabels:      namespaceLabelMap,
+			showKubeconfig:       showKubeconfig,
+			dryRun:               dryRun,
+			noRollback:           noRollback,
+			tokenMode:            tokenMode,
+			tokenTTL:             tokenTTL,
+			role:                 role,
+			authType:             authType,
+			acceptUntrustedCerts: acceptUntrustedCerts,
+			output:               output,
+			pipelines:            pipelines,
+			security:             security,
+			shareWithProjects:    shareWithProjects,
+			workloadIdentity:     workloadIdentity,
+		})
+		if _, ok := err.(*pendingChangesError); ok {
+			cmd.SilenceUsage = true
+		}
+
+		return err
 	},
 }
 
@@ -85,82 +181,281 @@ func init() {
 
 	kubernetesCmd.Flags().StringSliceP("namespace-label", "l", nil, "[default=] If a new Kubernetes namespace is created, these are the labels")
 	kubernetesCmd.Flags().Bool("show-kubeconfig", false, "[default=false] Show kubernetes kubeconfig if it was created")
+	kubernetesCmd.Flags().Bool("dry-run", false, "[default=false] Only look up the existing resources and print what would be created")
+	kubernetesCmd.Flags().Bool("no-rollback", false, "[default=false] Keep the resources created by this run when it fails, instead of removing them")
+	kubernetesCmd.Flags().String("token-mode", tokenModeSecret, "[default=secret] How the service account token is issued: secret (legacy token secret) or tokenrequest (bound token with expiration)")
+	kubernetesCmd.Flags().Duration("token-ttl", defaultTokenTTL, "[default=8760h] Token duration when token-mode is tokenrequest")
+	addAuthTypeFlags(kubernetesCmd.Flags())
+	addOutputFlag(kubernetesCmd.Flags())
+	addPipelineFlags(kubernetesCmd.Flags())
+	addSecurityRoleFlags(kubernetesCmd.Flags())
+	kubernetesCmd.Flags().StringArray("share-with-project", nil, "[default=] Share the service connection with another project of the same organization. Can be repeated")
+	kubernetesCmd.Flags().StringArray("cluster", nil, "[default=] Provision another cluster inside the environment (ex: context=prod-eu,serviceConnection=prod-eu-connection). Can be repeated and replaces --service-connection")
+	kubernetesCmd.Flags().String("role", "", "[default=] Role bound to the service account inside its namespace: namespace-admin, deployer, read-only or an existing ClusterRole name")
+}
+
+// rollbackTimeout limits how long the created resources are removed after a failure
+const rollbackTimeout = 2 * time.Minute
+
+// createKubernetesOptions holds everything needed to set up a kubernetes environment
+type createKubernetesOptions struct {
+	azDevOps             *azDevOpsSettings
+	targets              []kubernetesTarget
+	organizationProject  string
+	environmentName      string
+	serviceAccount       string
+	namespaceLabels      map[string]string
+	showKubeconfig       bool
+	dryRun               bool
+	noRollback           bool
+	tokenMode            string
+	tokenTTL             time.Duration
+	role                 string
+	authType             string
+	acceptUntrustedCerts bool
+	output               string
+	pipelines            *pipelineOptions
+	security             *securityOptions
+	shareWithProjects    []string
+	workloadIdentity     *services.WorkloadIdentityFederation
+}
+
+// pendingChangesError is returned by a dry-run when something would be changed
+type pendingChangesError struct {
+	changes int
 }
 
-func createKubernetes(pat, azDevOpsOrgProjectName, environmentName, namespaceServiceAccountName, serviceConnectionName string, namespaceLabels []string, showKubeconfig bool) error {
+func (e *pendingChangesError) Error() string {
+	return fmt.Sprintf("dry-run found %d pending change(s)", e.changes)
+}
+
+// createKubernetesResult is the document printed by -o json|yaml
+type createKubernetesResult struct {
+	DryRun             bool                      `json:"dryRun,omitempty"`
+	Environment        environmentSummary        `json:"environment"`
+	Namespace          string                    `json:"namespace"`
+	ServiceAccount     string                    `json:"serviceAccount"`
+	SecretName         string                    `json:"secretName,omitempty"`
+	ServiceConnections []serviceConnectionResult `json:"serviceConnections"`
+	Steps              []stepResult              `json:"steps"`
+	RolledBack         []string                  `json:"rolledBack,omitempty"`
+	Error              string                    `json:"error,omitempty"`
+}
+
+type serviceConnectionResult struct {
+	Id      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Cluster string `json:"cluster,omitempty"`
+}
+
+func createKubernetes(ctx context.Context, options createKubernetesOptions) error {
+	plan := plan{dryRun: options.dryRun}
+	result := createKubernetesResult{
+		DryRun:             options.dryRun,
+		ServiceConnections: []serviceConnectionResult{},
+	}
+
+	err := reconcileKubernetes(ctx, options, &plan, &result)
+	if err != nil && ctx.Err() != nil {
+		err = plan.interrupted(err)
+	}
+	if err != nil {
+		plan.fail()
+	}
+
+	if err != nil && !options.noRollback && len(plan.undos) > 0 {
+		// the run context may be canceled or timed out, the rollback gets its own time
+		rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		logger.Printf("Rolling back the %d resource(s) created by this run\n", len(plan.undos))
+		removed, failed := plan.rollback(rollbackCtx)
+		cancel()
+
+		result.RolledBack = removed
+		if len(removed) > 0 {
+			err = fmt.Errorf("%w (rolled back %s)", err, strings.Join(removed, ", "))
+		}
+		if len(failed) > 0 {
+			err = fmt.Errorf("%w (rollback failed for %s)", err, strings.Join(failed, ", "))
+		}
+	}
+
+	result.Steps = plan.results()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if options.output == outputJSON || options.output == outputYAML {
+		printErr := printOutput(os.Stdout, options.output, result, nil)
+		if err == nil {
+			err = printErr
+		}
+	} else if options.dryRun && err == nil {
+		err = plan.print(os.Stdout)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if options.dryRun {
+		if changes := plan.pendingChanges(); changes > 0 {
+			return &pendingChangesError{changes: changes}
+		}
+	}
+
+	return nil
+}
+
+// reconcileKubernetes sets up the environment and every cluster, recording the
+// steps in the plan and what was found or created in the result
+func reconcileKubernetes(ctx context.Context, options createKubernetesOptions, plan *plan, result *createKubernetesResult) error {
+	environmentName := options.environmentName
+	result.Environment.Name = environmentName
+
 	// environment
 	// -----------
-	azDevOpsOrgProjParts := strings.Split(azDevOpsOrgProjectName, "/")
-	if len(azDevOpsOrgProjParts) != 2 {
-		return fmt.Errorf("invalid format for Azure DevOps project, please use like this: organization/project-name")
-	}
-	azDevOpsOrganizationName := azDevOpsOrgProjParts[0]
-	azDevOpsProjectName := azDevOpsOrgProjParts[1]
-	azdevOps := services.AzDevOps{
-		Pat:          pat,
-		Organization: azDevOpsOrganizationName,
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(options.organizationProject)
+	if err != nil {
+		return err
 	}
+	azdevOps := options.azDevOps.newAzDevOps(azDevOpsOrganizationName)
 
 	// looking for specified azDevOpsEnvironment
-	azDevOpsEnvironment, err := azdevOps.FindEnvironment(azDevOpsProjectName, environmentName)
+	azDevOpsEnvironment, err := azdevOps.FindEnvironment(ctx, azDevOpsProjectName, environmentName)
 	if services.IgnoreResourceNotFoundError(err) != nil {
-		return fmt.Errorf("error looking for environment %s: %v", environmentName, err)
+		return fmt.Errorf("error looking for environment %s: %w", environmentName, err)
 	}
 
 	if azDevOpsEnvironment == nil {
-		// if specified environment was not found, create a new one
-		azDevOpsEnvironment, err = azdevOps.CreateEnvironment(azDevOpsProjectName, environmentName)
-		if err != nil {
-			return err
-		}
+		step := plan.add("environment", environmentName, planActionCreate, "")
+		if !options.dryRun {
+			// if specified environment was not found, create a new one
+			azDevOpsEnvironment, err = azdevOps.CreateEnvironment(ctx, azDevOpsProjectName, environmentName)
+			if err != nil {
+				return err
+			}
 
-		logger.Printf("Created environment %s\n", azDevOpsEnvironment.Name)
+			environmentId := azDevOpsEnvironment.Id
+			plan.created(step, func(ctx context.Context) error {
+				return azdevOps.DeleteEnvironment(ctx, azDevOpsProjectName, environmentId)
+			})
+
+			logger.Printf("Created environment %s\n", azDevOpsEnvironment.Name)
+		}
 	} else {
+		plan.add("environment", environmentName, planActionExists, "")
 		logger.Printf("Environment %s already exists\n", azDevOpsEnvironment.Name)
 	}
 
-	// namespace
-	// ---------
+	if azDevOpsEnvironment != nil {
+		result.Environment.Id = azDevOpsEnvironment.Id
+	}
 
 	// split namespace from serviceaccount name
-	namespaceServiceAccountNameParts := strings.Split(namespaceServiceAccountName, "/")
-	if len(namespaceServiceAccountNameParts) != 2 {
-		return fmt.Errorf("invalid format for service-account, please use like this: namespace/serviceaccount-name")
+	namespaceName, serviceAccountName, err := splitNamespaceServiceAccount(options.serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	result.Namespace = namespaceName
+	result.ServiceAccount = serviceAccountName
+	if options.authType != authTypeWorkloadIdentity && options.tokenMode == tokenModeSecret {
+		result.SecretName = serviceAccountSecretName(serviceAccountName)
+	}
+
+	// clusters
+	// --------
+	serviceConnections := make([]*services.AzDevopsServiceEndpoint, len(options.targets))
+	for i, target := range options.targets {
+		if target.context != "" {
+			logger.Printf("Provisioning cluster %s\n", target.context)
+		}
+
+		serviceConnections[i], err = provisionKubernetesTarget(ctx, azdevOps, azDevOpsProjectName, plan, options, target, namespaceName, serviceAccountName)
+		if err != nil {
+			return err
+		}
+
+		serviceConnection := serviceConnectionResult{
+			Name:    target.serviceConnectionName,
+			Cluster: target.context,
+		}
+		if serviceConnections[i] != nil {
+			serviceConnection.Id = serviceConnections[i].Id
+		}
+		result.ServiceConnections = append(result.ServiceConnections, serviceConnection)
+
+		err = ensureServiceConnectionShared(ctx, azdevOps, plan, options.dryRun, target.serviceConnectionName, serviceConnections[i], options.shareWithProjects)
+		if err != nil {
+			return err
+		}
 	}
 
-	// looking for specified kubernetes service account
-	namespaceName := namespaceServiceAccountNameParts[0]
-	serviceAccountName := namespaceServiceAccountNameParts[1]
+	// environment resources
+	// ---------------------
+	err = registerEnvironmentResources(ctx, azdevOps, azDevOpsProjectName, azDevOpsEnvironment, plan, options, namespaceName, serviceConnections)
+	if err != nil {
+		return err
+	}
 
-	kubernetes := services.Kubernetes{
-		Config: ctrl.GetConfigOrDie(),
+	// pipelines
+	// ---------
+	err = ensurePipelines(ctx, azdevOps, azDevOpsProjectName, plan, options, azDevOpsEnvironment, serviceConnections)
+	if err != nil {
+		return err
 	}
-	ctx := context.Background()
+
+	// security
+	// --------
+	return ensureSecurityRoles(ctx, azdevOps, azDevOpsProjectName, plan, options, azDevOpsEnvironment, serviceConnections)
+}
+
+// provisionKubernetesTarget sets up the namespace, service account, service
+// connection and role of a single cluster, returning its service connection.
+// It is nil in a dry-run when the service connection would be created
+func provisionKubernetesTarget(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, plan *plan, options createKubernetesOptions, target kubernetesTarget, namespaceName, serviceAccountName string) (*services.AzDevopsServiceEndpoint, error) {
+	kubernetes := target.kubernetes
+	serviceConnectionName := target.serviceConnectionName
+
+	// namespace
+	// ---------
 	namespace, err := kubernetes.GetNamespace(ctx, namespaceName)
 	if services.IgnoreResourceNotFoundError(err) != nil {
-		return fmt.Errorf("error looking for namespace %s: %v", namespaceName, err)
+		return nil, fmt.Errorf("error looking for namespace %s: %w", namespaceName, err)
 	}
 
+	var currentLabels map[string]string
 	if namespace == nil {
-		namespace, err = kubernetes.CreateNamespace(ctx, namespaceName)
-		if err != nil {
-			return fmt.Errorf("error creating namespace %s: %v", namespaceName, err)
-		}
+		step := plan.add("namespace", target.displayName(namespaceName), planActionCreate, "")
+		if !options.dryRun {
+			namespace, err = kubernetes.CreateNamespace(ctx, namespaceName)
+			if err != nil {
+				return nil, fmt.Errorf("error creating namespace %s: %w", namespaceName, err)
+			}
 
-		logger.Printf("Namespace %s created\n", namespace.Name)
+			plan.created(step, func(ctx context.Context) error {
+				return kubernetes.DeleteNamespace(ctx, namespaceName)
+			})
+
+			logger.Printf("Namespace %s created\n", namespace.Name)
+		}
 	} else {
-		logger.Printf("Namespace %s already exists\n", azDevOpsEnvironment.Name)
+		currentLabels = namespace.Labels
+		plan.add("namespace", target.displayName(namespaceName), planActionExists, "")
+		logger.Printf("Namespace %s already exists\n", namespace.Name)
 	}
 
 	// update namespace labels
-	if len(namespaceLabels) > 0 {
-		namespaceLabelMap, err := stringArrayToMap(namespaceLabels)
-		if err != nil {
-			return fmt.Errorf("error processing specified labels: %v", err)
-		}
-		err = kubernetes.UpdateNamespaceLabels(ctx, namespaceName, namespaceLabelMap)
-		if err != nil {
-			return fmt.Errorf("error updating namespace %s labels: %v", namespaceName, err)
+	labelChanges := labelsDiff(currentLabels, options.namespaceLabels)
+	if len(labelChanges) > 0 {
+		step := plan.add("namespace labels", target.displayName(namespaceName), planActionUpdate, strings.Join(labelChanges, ", "))
+		if !options.dryRun {
+			err = kubernetes.UpdateNamespaceLabels(ctx, namespaceName, options.namespaceLabels)
+			if err != nil {
+				return nil, fmt.Errorf("error updating namespace %s labels: %w", namespaceName, err)
+			}
+
+			plan.done(step)
 		}
 	}
 
@@ -168,121 +463,319 @@ func createKubernetes(pat, azDevOpsOrgProjectName, environmentName, namespaceSer
 	// ----------------
 
 	// looking for specified service connection
-	serviceConnection, err := azdevOps.FindServiceEndpoint(azDevOpsProjectName, serviceConnectionName)
+	serviceConnection, err := azdevOps.FindServiceEndpoint(ctx, azDevOpsProjectName, serviceConnectionName)
 	if services.IgnoreResourceNotFoundError(err) != nil {
-		return fmt.Errorf("error looking for service connection %s: %v", serviceConnectionName, err)
+		return nil, fmt.Errorf("error looking for service connection %s: %w", serviceConnectionName, err)
 	}
 
+	secretName := serviceAccountSecretName(serviceAccountName)
 	if serviceConnection == nil {
-		k8sServiceAccount, err := kubernetes.GetServiceAccount(ctx, namespaceName, serviceAccountName)
-		if services.IgnoreResourceNotFoundError(err) != nil {
-			return fmt.Errorf("error looking for service account %s: %v", serviceAccountName, err)
+		var secret *v1.Secret
+		if options.authType == authTypeWorkloadIdentity {
+			plan.add("service account", target.displayName(namespaceName+"/"+serviceAccountName), planActionSkip, "auth type is workload-identity")
+			plan.add("secret", target.displayName(namespaceName+"/"+secretName), planActionSkip, "auth type is workload-identity")
+		} else {
+			secret, err = ensureServiceAccount(ctx, kubernetes, plan, options, target, namespaceName, serviceAccountName)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		if k8sServiceAccount == nil {
-			k8sServiceAccount, err = kubernetes.CreateServiceAccount(ctx, namespaceName, serviceAccountName)
-			if err != nil {
-				return fmt.Errorf("error creating service account %s: %v", serviceAccountName, err)
+		step := plan.add("service connection", serviceConnectionName, planActionCreate, "auth type "+options.authType)
+		if !options.dryRun {
+			var token *serviceAccountToken
+			var credentials *services.KubernetesEndpointCredentials
+			if options.authType == authTypeWorkloadIdentity {
+				workloadIdentity := *options.workloadIdentity
+				workloadIdentity.Namespace = namespaceName
+				credentials = services.NewWorkloadIdentityCredentials(workloadIdentity)
+			} else {
+				token, err = getServiceAccountToken(ctx, kubernetes, namespaceName, serviceAccountName, secret, options.tokenMode, options.tokenTTL)
+				if err != nil {
+					return nil, err
+				}
+
+				credentials, err = newEndpointCredentials(kubernetes, options.authType, namespaceName, serviceAccountName, token, options.showKubeconfig, options.acceptUntrustedCerts)
+				if err != nil {
+					return nil, err
+				}
 			}
 
-			logger.Printf("Kubernetes service account %s/%s created\n", namespaceName, serviceAccountName)
-		} else {
-			logger.Printf("Kubernetes service account %s/%s already exists\n", namespaceName, serviceAccountName)
+			serviceConnection, err = createKubernetesServiceConnection(ctx, azdevOps, plan, step, azDevOpsProjectName, serviceConnectionName, serviceConnectionDescription("Created", token), credentials)
+			if err != nil {
+				return nil, err
+			}
 		}
+	} else {
+		plan.add("service account", target.displayName(namespaceName+"/"+serviceAccountName), planActionSkip, "service connection already exists")
+		plan.add("secret", target.displayName(namespaceName+"/"+secretName), planActionSkip, "service connection already exists")
+		plan.add("service connection", serviceConnectionName, planActionExists, "")
+		logger.Printf("Created service connection %s already exists\n", serviceConnectionName)
+	}
 
-		// look up the secret
-		secretName := fmt.Sprintf("%s-token", serviceAccountName)
-		secret, err := kubernetes.GetSecret(ctx, namespaceName, secretName)
-		if services.IgnoreResourceNotFoundError(err) != nil {
-			return fmt.Errorf("error looking for secret %s: %v", secretName, err)
+	// rbac
+	// ----
+	if options.role != "" {
+		err = ensureServiceAccountRole(ctx, kubernetes, plan, options.dryRun, namespaceName, serviceAccountName, options.role)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		if secret == nil {
-			secret, err = kubernetes.CreateSecret(ctx, namespaceName, secretName, serviceAccountName)
-			if err != nil {
-				return fmt.Errorf("error creating secret for service account %s: %v", serviceAccountName, err)
-			}
+	return serviceConnection, nil
+}
 
-			logger.Printf("Kubernetes secret %s/%s created\n", namespaceName, secretName)
-		} else {
-			logger.Printf("Kubernetes secret %s/%s already exists\n", namespaceName, secretName)
+// registerEnvironmentResources registers the namespace of every cluster inside
+// the environment. A resource of the namespace using a service connection of
+// none of the clusters is replaced, since resources can't be changed
+func registerEnvironmentResources(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, azDevOpsEnvironment *services.AzDevopsEnvironmentInstance, plan *plan, options createKubernetesOptions, namespaceName string, serviceConnections []*services.AzDevopsServiceEndpoint) error {
+	environmentName := options.environmentName
+
+	var kubernetesResources []services.AzDevopsKubernetesResource
+	if azDevOpsEnvironment != nil {
+		var err error
+		kubernetesResources, err = azdevOps.ListKubernetesResources(ctx, azDevOpsProjectName, azDevOpsEnvironment.Id)
+		if err != nil {
+			return fmt.Errorf("error looking for resources inside environment %s: %w", environmentName, err)
 		}
+	}
 
-		// validate the secret type
-		if secret.Type != v1.SecretTypeServiceAccountToken {
-			return fmt.Errorf("secret %s/%s found but it's not a service account token secret! Please, try to delete the secret and let this tool creat it again", namespaceName, secretName)
+	serviceConnectionIds := map[string]bool{}
+	for _, serviceConnection := range serviceConnections {
+		if serviceConnection != nil {
+			serviceConnectionIds[serviceConnection.Id] = true
 		}
+	}
 
-		// validate the secret fields
-		validatedSecret := false
-		for tries := 0; tries < 5; tries++ {
-			validatedSecret = validateSecretTokenFields(secret)
-			if validatedSecret {
-				break
+	claimed := map[int]bool{}
+	for i, target := range options.targets {
+		serviceConnection := serviceConnections[i]
+		serviceConnectionName := target.serviceConnectionName
+
+		var kubernetesResource, staleResource *services.AzDevopsKubernetesResource
+		for j := range kubernetesResources {
+			resource := &kubernetesResources[j]
+			if resource.Namespace != namespaceName || claimed[resource.Id] {
+				continue
 			}
 
-			secret, err = kubernetes.GetSecret(ctx, namespaceName, secretName)
-			if err != nil {
-				return fmt.Errorf("error looking for kubernetes secret %s: %v", secretName, err)
+			if serviceConnection != nil && resource.ServiceEndpointId == serviceConnection.Id {
+				kubernetesResource = resource
+				break
 			}
 
-			time.Sleep(time.Millisecond * 250)
+			if staleResource == nil && !serviceConnectionIds[resource.ServiceEndpointId] {
+				staleResource = resource
+			}
 		}
 
-		if !validatedSecret {
-			return fmt.Errorf("error validating secret  %s/%s. It doesn't have token or ca.crt fields", namespaceName, secretName)
+		if kubernetesResource != nil {
+			claimed[kubernetesResource.Id] = true
+			plan.add("environment resource", target.displayName(namespaceName), planActionExists, "")
+			logger.Printf("Resource %s inside environment %s already exists\n", namespaceName, environmentName)
+		} else if staleResource != nil {
+			claimed[staleResource.Id] = true
+			step := plan.add("environment resource", target.displayName(namespaceName), planActionUpdate, fmt.Sprintf("replace service connection %s by %s", staleResource.ServiceEndpointId, serviceConnectionName))
+			if !options.dryRun {
+				// resources are named after the namespace, so the stale one goes first.
+				// The rollback recreates it as it was if the run fails afterwards
+				err := azdevOps.DeleteKubernetesResource(ctx, azDevOpsProjectName, azDevOpsEnvironment.Id, staleResource.Id)
+				if err != nil {
+					return fmt.Errorf("error deleting resource %s inside environment %s: %w", namespaceName, environmentName, err)
+				}
+
+				stale := *staleResource
+				environmentId := azDevOpsEnvironment.Id
+				plan.undoable(step, func(ctx context.Context) error {
+					return azdevOps.CreateResourceEnvironment(ctx, stale.Name, azDevOpsProjectName, stale.Namespace, stale.ClusterName, stale.ServiceEndpointId, environmentId)
+				})
+
+				err = azdevOps.CreateResourceEnvironment(ctx, namespaceName, azDevOpsProjectName, namespaceName, target.context, serviceConnection.Id, azDevOpsEnvironment.Id)
+				if err != nil {
+					return err
+				}
+
+				createdEnvironmentResource(plan, step, azdevOps, azDevOpsProjectName, azDevOpsEnvironment.Id, namespaceName, serviceConnection)
+
+				logger.Printf("Replaced resource %s inside environment %s to use service connection %s\n", namespaceName, environmentName, serviceConnectionName)
+			}
+		} else {
+			step := plan.add("environment resource", target.displayName(namespaceName), planActionCreate, fmt.Sprintf("environment %s, service connection %s", environmentName, serviceConnectionName))
+			if !options.dryRun {
+				err := azdevOps.CreateResourceEnvironment(ctx, namespaceName, azDevOpsProjectName, namespaceName, target.context, serviceConnection.Id, azDevOpsEnvironment.Id)
+				if err != nil {
+					return err
+				}
+
+				createdEnvironmentResource(plan, step, azdevOps, azDevOpsProjectName, azDevOpsEnvironment.Id, namespaceName, serviceConnection)
+
+				logger.Printf("Created resource %s inside environment %s\n", namespaceName, environmentName)
+			}
 		}
+	}
 
-		serviceAccountToken := string(secret.Data["token"])
-		kubeconfig, err := kubernetes.CreateKubeconfig(k8sServiceAccount.Name, namespaceName, serviceAccountToken)
-		if err != nil {
-			return fmt.Errorf("error generating kubernetes kubeconfig: %v", err.Error())
+	return nil
+}
+
+// createdEnvironmentResource records how to remove the resource registered
+// inside the environment, looked up by namespace and service connection since
+// its id isn't returned
+func createdEnvironmentResource(plan *plan, step int, azdevOps *services.AzDevOps, azDevOpsProjectName string, environmentId int, namespaceName string, serviceConnection *services.AzDevopsServiceEndpoint) {
+	plan.created(step, func(ctx context.Context) error {
+		kubernetesResource, err := findEnvironmentResource(ctx, azdevOps, azDevOpsProjectName, environmentId, namespaceName, serviceConnection)
+		if err != nil || kubernetesResource == nil {
+			return err
 		}
-		logger.Printf("Kubernetes kubeconfig created\n")
 
-		if showKubeconfig {
-			logger.Println(kubeconfig)
+		return azdevOps.DeleteKubernetesResource(ctx, azDevOpsProjectName, environmentId, kubernetesResource.Id)
+	})
+}
+
+// ensureServiceAccount looks up (or creates) the service account and, for the
+// secret token mode, its token secret
+func ensureServiceAccount(ctx context.Context, kubernetes *services.Kubernetes, plan *plan, options createKubernetesOptions, target kubernetesTarget, namespaceName, serviceAccountName string) (*v1.Secret, error) {
+	k8sServiceAccount, err := kubernetes.GetServiceAccount(ctx, namespaceName, serviceAccountName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return nil, fmt.Errorf("error looking for service account %s: %w", serviceAccountName, err)
+	}
+
+	if k8sServiceAccount == nil {
+		step := plan.add("service account", target.displayName(namespaceName+"/"+serviceAccountName), planActionCreate, "")
+		if !options.dryRun {
+			_, err = kubernetes.CreateServiceAccount(ctx, namespaceName, serviceAccountName)
+			if err != nil {
+				return nil, fmt.Errorf("error creating service account %s: %w", serviceAccountName, err)
+			}
+
+			plan.created(step, func(ctx context.Context) error {
+				return kubernetes.DeleteServiceAccount(ctx, namespaceName, serviceAccountName)
+			})
+
+			logger.Printf("Kubernetes service account %s/%s created\n", namespaceName, serviceAccountName)
 		}
+	} else {
+		plan.add("service account", target.displayName(namespaceName+"/"+serviceAccountName), planActionExists, "")
+		logger.Printf("Kubernetes service account %s/%s already exists\n", namespaceName, serviceAccountName)
+	}
 
-		project, err := azdevOps.FindProject(azDevOpsProjectName)
-		if err != nil {
-			return fmt.Errorf("error looking for Azure DevOps project %s: %v", azDevOpsProjectName, err)
+	secretName := serviceAccountSecretName(serviceAccountName)
+	if options.tokenMode == tokenModeTokenRequest {
+		plan.add("secret", target.displayName(namespaceName+"/"+secretName), planActionSkip, "token mode is tokenrequest")
+		return nil, nil
+	}
+
+	// look up the secret
+	secret, err := kubernetes.GetSecret(ctx, namespaceName, secretName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return nil, fmt.Errorf("error looking for secret %s: %w", secretName, err)
+	}
+
+	if secret == nil {
+		step := plan.add("secret", target.displayName(namespaceName+"/"+secretName), planActionCreate, "")
+		if options.dryRun {
+			return nil, nil
 		}
 
-		serviceConnection, err = azdevOps.CreateServiceEndpoint(
-			project.ID,
-			serviceConnectionName,
-			fmt.Sprintf("Created by cli azenv at %s", time.Now().Local().Format("2 Jan 2006 15:04:05")),
-			kubeconfig,
-		)
+		secret, err = kubernetes.CreateSecret(ctx, namespaceName, secretName, serviceAccountName)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("error creating secret for service account %s: %w", serviceAccountName, err)
 		}
 
-		logger.Printf("Created service connection %s\n", serviceConnectionName)
+		plan.created(step, func(ctx context.Context) error {
+			return kubernetes.DeleteSecret(ctx, namespaceName, secretName)
+		})
+
+		logger.Printf("Kubernetes secret %s/%s created\n", namespaceName, secretName)
 	} else {
-		logger.Printf("Created service connection %s already exists\n", serviceConnectionName)
+		plan.add("secret", target.displayName(namespaceName+"/"+secretName), planActionExists, "")
+		logger.Printf("Kubernetes secret %s/%s already exists\n", namespaceName, secretName)
 	}
 
-	err = azdevOps.CreateResourceEnvironment(namespaceName, azDevOpsProjectName, namespaceName, serviceConnection.Id, azDevOpsEnvironment.Id)
+	// validate the secret type
+	if secret.Type != v1.SecretTypeServiceAccountToken {
+		return nil, fmt.Errorf("secret %s/%s found but it's not a service account token secret! Please, try to delete the secret and let this tool creat it again", namespaceName, secretName)
+	}
+
+	return secret, nil
+}
+
+// createKubernetesServiceConnection registers a new service connection in the project
+func createKubernetesServiceConnection(ctx context.Context, azdevOps *services.AzDevOps, plan *plan, step int, azDevOpsProjectName, serviceConnectionName, description string, credentials *services.KubernetesEndpointCredentials) (*services.AzDevopsServiceEndpoint, error) {
+	project, err := azdevOps.FindProject(ctx, azDevOpsProjectName)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error looking for Azure DevOps project %s: %w", azDevOpsProjectName, err)
 	}
 
-	logger.Printf("Created resource %s inside environment %s\n", serviceConnectionName, azDevOpsEnvironment.Name)
+	serviceConnection, err := azdevOps.CreateServiceEndpoint(
+		ctx,
+		project.ID,
+		serviceConnectionName,
+		description,
+		credentials,
+	)
+	if errors.Is(err, services.ErrConflict) {
+		return nil, fmt.Errorf("service connection name %s is already in use, maybe by a service connection of another type: %w", serviceConnectionName, err)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	serviceConnectionId := serviceConnection.Id
+	plan.created(step, func(ctx context.Context) error {
+		// the run may have shared it with other projects, it must leave them too
+		projectIds := []string{project.ID}
+		current, err := azdevOps.FindServiceEndpoint(ctx, azDevOpsProjectName, serviceConnectionName)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return err
+		}
+		if current != nil {
+			projectIds = current.ProjectIds(project.ID)
+		}
+
+		return azdevOps.DeleteServiceEndpoint(ctx, serviceConnectionId, projectIds)
+	})
+
+	logger.Printf("Created service connection %s\n", serviceConnectionName)
+
+	return serviceConnection, nil
 }
 
-func validateSecretTokenFields(secret *v1.Secret) bool {
-	fieldsForValidation := []string{"token", "ca.crt"}
-	for _, field := range fieldsForValidation {
-		if _, ok := secret.Data[field]; !ok {
-			return false
+// labelsDiff lists the labels that must be added or changed to reach the desired ones
+func labelsDiff(current, desired map[string]string) []string {
+	changes := []string{}
+	for k, v := range desired {
+		currentValue, ok := current[k]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+%s=%s", k, v))
+		} else if currentValue != v {
+			changes = append(changes, fmt.Sprintf("~%s=%s (was %s)", k, v, currentValue))
 		}
 	}
+	sort.Strings(changes)
+
+	return changes
+}
+
+func serviceAccountSecretName(serviceAccountName string) string {
+	return fmt.Sprintf("%s-token", serviceAccountName)
+}
+
+func splitOrganizationProject(organizationProject string) (string, string, error) {
+	parts := strings.Split(organizationProject, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid format for Azure DevOps project, please use like this: organization/project-name")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func splitNamespaceServiceAccount(namespaceServiceAccount string) (string, string, error) {
+	parts := strings.Split(namespaceServiceAccount, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid format for service-account, please use like this: namespace/serviceaccount-name")
+	}
 
-	return true
+	return parts[0], parts[1], nil
 }
 
 func stringArrayToMap(arrayItems []string) (map[string]string, error) {
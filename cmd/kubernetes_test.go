@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelsDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]string
+		desired map[string]string
+		want    []string
+	}{
+		{name: "no labels", current: nil, desired: nil, want: []string{}},
+		{name: "same labels", current: map[string]string{"a": "1", "b": "2"}, desired: map[string]string{"a": "1"}, want: []string{}},
+		{name: "new labels", current: nil, desired: map[string]string{"b": "2", "a": "1"}, want: []string{"+a=1", "+b=2"}},
+		{name: "changed label", current: map[string]string{"a": "1"}, desired: map[string]string{"a": "2"}, want: []string{"~a=2 (was 1)"}},
+		{name: "empty value", current: map[string]string{"a": ""}, desired: map[string]string{"a": "", "b": ""}, want: []string{"+b="}},
+		{
+			name:    "sorted",
+			current: map[string]string{"c": "1", "z": "1"},
+			desired: map[string]string{"z": "2", "c": "1", "b": "1"},
+			want:    []string{"+b=1", "~z=2 (was 1)"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := labelsDiff(test.current, test.desired)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("labelsDiff() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
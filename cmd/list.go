@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "list",
+	Short:  "List environments or service connections",
+	Long:   `Use this command to list AzureDevOps Environments or Kubernetes service connections of a project`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Println("Error: must also specify a resource like environments or service-connections")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
+	err := listCmd.MarkPersistentFlagRequired("project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addOutputFlag(listCmd.PersistentFlags())
+	addAzDevOpsFlags(listCmd.PersistentFlags())
+}
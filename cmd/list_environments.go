@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// listEnvironmentsCmd represents the list environments command
+var listEnvironmentsCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "environments",
+	Short:  "List environments",
+	Long:   `Use this command to list the AzureDevOps Environments of a project`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		output, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listEnvironments(cmd.Context(), azDevOpsSettings, organizationProject, output)
+	},
+}
+
+func init() {
+	listCmd.AddCommand(listEnvironmentsCmd)
+}
+
+// environmentSummary is an environment in the list output
+type environmentSummary struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func listEnvironments(ctx context.Context, azDevOpsSettings *azDevOpsSettings, azDevOpsOrgProjectName, output string) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+	environments, err := azdevOps.ListEnvironments(ctx, azDevOpsProjectName)
+	if err != nil {
+		return fmt.Errorf("error listing environments: %w", err)
+	}
+
+	summaries := make([]environmentSummary, 0, len(environments))
+	for _, environment := range environments {
+		summaries = append(summaries, environmentSummary{
+			Id:   environment.Id,
+			Name: environment.Name,
+		})
+	}
+
+	return printOutput(os.Stdout, output, summaries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME")
+		for _, summary := range summaries {
+			fmt.Fprintf(w, "%d\t%s\n", summary.Id, summary.Name)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// listServiceConnectionsCmd represents the list service-connections command
+var listServiceConnectionsCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "service-connections",
+	Short:  "List Kubernetes service connections",
+	Long:   `Use this command to list the AzureDevOps Kubernetes service connections of a project`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		output, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listServiceConnections(cmd.Context(), azDevOpsSettings, organizationProject, output)
+	},
+}
+
+func init() {
+	listCmd.AddCommand(listServiceConnectionsCmd)
+}
+
+// serviceConnectionSummary is a service connection in the list output, without credentials
+type serviceConnectionSummary struct {
+	Id                string `json:"id"`
+	Name              string `json:"name"`
+	AuthorizationType string `json:"authorizationType"`
+	URL               string `json:"url"`
+	Description       string `json:"description,omitempty"`
+}
+
+func listServiceConnections(ctx context.Context, azDevOpsSettings *azDevOpsSettings, azDevOpsOrgProjectName, output string) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+	serviceConnections, err := azdevOps.ListServiceEndpoints(ctx, azDevOpsProjectName)
+	if err != nil {
+		return fmt.Errorf("error listing service connections: %w", err)
+	}
+
+	summaries := make([]serviceConnectionSummary, 0, len(serviceConnections))
+	for _, serviceConnection := range serviceConnections {
+		authorizationType, _ := serviceConnection.Data["authorizationType"].(string)
+		summaries = append(summaries, serviceConnectionSummary{
+			Id:                serviceConnection.Id,
+			Name:              serviceConnection.Name,
+			AuthorizationType: authorizationType,
+			URL:               serviceConnection.URL,
+			Description:       serviceConnection.Description,
+		})
+	}
+
+	return printOutput(os.Stdout, output, summaries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tAUTHORIZATION\tURL")
+		for _, summary := range summaries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", summary.Id, summary.Name, summary.AuthorizationType, summary.URL)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+func addOutputFlag(flags *pflag.FlagSet) {
+	flags.StringP("output", "o", outputTable, "[default=table] Output format: table, json or yaml")
+}
+
+func getOutputFormat(cmd *cobra.Command) (string, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", err
+	}
+
+	switch output {
+	case outputTable, outputJSON, outputYAML:
+		return output, nil
+	}
+
+	return "", fmt.Errorf("invalid output %s, please use %s, %s or %s", output, outputTable, outputJSON, outputYAML)
+}
+
+// printOutput writes the value as JSON or YAML, or calls printTable for the table output
+func printOutput(out io.Writer, output string, value interface{}, printTable func(w *tabwriter.Writer)) error {
+	switch output {
+	case outputJSON:
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case outputYAML:
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write(data)
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	printTable(w)
+
+	return w.Flush()
+}
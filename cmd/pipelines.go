@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	authorizePipelinesAll = "all"
+
+	// check timeouts, in minutes
+	approvalTimeout      = 30 * 24 * 60
+	businessHoursTimeout = 24 * 60
+)
+
+var defaultBusinessDays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"}
+
+// pipelineOptions sets which pipelines can use the environment and service
+// connections and the checks they must pass
+type pipelineOptions struct {
+	authorizeAll  bool
+	pipelineIds   []int
+	approvers     []string
+	businessHours *businessHours
+}
+
+type businessHours struct {
+	days     []string
+	start    string
+	end      string
+	timeZone string
+}
+
+func addPipelineFlags(flags *pflag.FlagSet) {
+	flags.String("authorize-pipelines", "", "[default=] Pipelines allowed to use the environment and service connections: all or a comma separated list of pipeline ids")
+	flags.StringArray("approver", nil, "[default=] Required approver of the environment, a user or group account (ex: user@example.com). Can be repeated")
+	flags.String("business-hours", "", "[default=] Only allow deployments to the environment inside these hours (ex: 08:00-18:00)")
+	flags.StringSlice("business-days", defaultBusinessDays, "[default=Monday,Tuesday,Wednesday,Thursday,Friday] Days of business-hours")
+	flags.String("business-time-zone", "UTC", "[default=UTC] Time zone of business-hours, as a Windows time zone id (ex: E. South America Standard Time)")
+}
+
+func getPipelineFlags(cmd *cobra.Command) (*pipelineOptions, error) {
+	authorizePipelines, err := cmd.Flags().GetString("authorize-pipelines")
+	if err != nil {
+		return nil, err
+	}
+
+	approvers, err := cmd.Flags().GetStringArray("approver")
+	if err != nil {
+		return nil, err
+	}
+
+	hours, err := cmd.Flags().GetString("business-hours")
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := cmd.Flags().GetStringSlice("business-days")
+	if err != nil {
+		return nil, err
+	}
+
+	timeZone, err := cmd.Flags().GetString("business-time-zone")
+	if err != nil {
+		return nil, err
+	}
+
+	return newPipelineOptions(authorizePipelines, approvers, hours, days, timeZone)
+}
+
+// newPipelineOptions validates the pipeline settings
+func newPipelineOptions(authorizePipelines string, approvers []string, hours string, days []string, timeZone string) (*pipelineOptions, error) {
+	options := &pipelineOptions{
+		approvers: approvers,
+	}
+
+	if authorizePipelines == authorizePipelinesAll {
+		options.authorizeAll = true
+	} else if authorizePipelines != "" {
+		for _, id := range strings.Split(authorizePipelines, ",") {
+			pipelineId, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return nil, fmt.Errorf("invalid authorize-pipelines %s, please use all or a comma separated list of pipeline ids", authorizePipelines)
+			}
+
+			options.pipelineIds = append(options.pipelineIds, pipelineId)
+		}
+	}
+
+	if hours != "" {
+		start, end, ok := strings.Cut(hours, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid business-hours %s, please use like this: 08:00-18:00", hours)
+		}
+
+		for _, value := range []string{start, end} {
+			_, err := time.Parse("15:04", value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid business-hours %s, please use like this: 08:00-18:00", hours)
+			}
+		}
+
+		if len(days) == 0 {
+			days = defaultBusinessDays
+		}
+
+		options.businessHours = &businessHours{
+			days:     days,
+			start:    start,
+			end:      end,
+			timeZone: timeZone,
+		}
+	}
+
+	return options, nil
+}
+
+// ensurePipelines authorizes the pipelines to use the environment and the
+// service connections and sets up the environment checks
+func ensurePipelines(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, plan *plan, options createKubernetesOptions, environment *services.AzDevopsEnvironmentInstance, serviceConnections []*services.AzDevopsServiceEndpoint) error {
+	if options.pipelines == nil {
+		return nil
+	}
+
+	environmentId := ""
+	if environment != nil {
+		environmentId = strconv.Itoa(environment.Id)
+	}
+
+	err := ensurePipelineAuthorization(ctx, azdevOps, azDevOpsProjectName, plan, options.dryRun, options.pipelines, services.PIPELINE_RESOURCE_TYPE_ENVIRONMENT, environmentId, "environment "+options.environmentName)
+	if err != nil {
+		return err
+	}
+
+	for i, target := range options.targets {
+		serviceConnectionId := ""
+		if serviceConnections[i] != nil {
+			serviceConnectionId = serviceConnections[i].Id
+		}
+
+		err = ensurePipelineAuthorization(ctx, azdevOps, azDevOpsProjectName, plan, options.dryRun, options.pipelines, services.PIPELINE_RESOURCE_TYPE_ENDPOINT, serviceConnectionId, "service connection "+target.serviceConnectionName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ensureEnvironmentChecks(ctx, azdevOps, azDevOpsProjectName, plan, options.dryRun, options.pipelines, options.environmentName, environment)
+}
+
+// ensurePipelineAuthorization authorizes the pipelines to use the resource.
+// An empty resource id means the resource will be created by this run
+func ensurePipelineAuthorization(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, plan *plan, dryRun bool, options *pipelineOptions, resourceType, resourceId, resourceName string) error {
+	if !options.authorizeAll && len(options.pipelineIds) == 0 {
+		return nil
+	}
+
+	current := &services.AzDevopsPipelinePermissions{}
+	if resourceId != "" {
+		var err error
+		current, err = azdevOps.GetPipelinePermissions(ctx, azDevOpsProjectName, resourceType, resourceId)
+		if err != nil {
+			return fmt.Errorf("error looking for pipeline permissions of %s: %w", resourceName, err)
+		}
+	}
+
+	desired := &services.AzDevopsPipelinePermissions{
+		Pipelines: []services.AzDevopsPipelinePermission{},
+	}
+	changes := []string{}
+	if options.authorizeAll {
+		if current.AllPipelines == nil || !current.AllPipelines.Authorized {
+			desired.AllPipelines = &services.AzDevopsPipelinePermission{Authorized: true}
+			changes = append(changes, "all pipelines")
+		}
+	} else {
+		authorized := map[int]bool{}
+		for _, pipeline := range current.Pipelines {
+			authorized[pipeline.Id] = pipeline.Authorized
+		}
+
+		for _, pipelineId := range options.pipelineIds {
+			if !authorized[pipelineId] {
+				desired.Pipelines = append(desired.Pipelines, services.AzDevopsPipelinePermission{Id: pipelineId, Authorized: true})
+				changes = append(changes, "pipeline "+strconv.Itoa(pipelineId))
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		plan.add("pipeline permissions", resourceName, planActionExists, "")
+		logger.Printf("Pipelines already authorized to use %s\n", resourceName)
+
+		return nil
+	}
+
+	step := plan.add("pipeline permissions", resourceName, planActionUpdate, "authorize "+strings.Join(changes, ", "))
+	if dryRun {
+		return nil
+	}
+
+	err := azdevOps.UpdatePipelinePermissions(ctx, azDevOpsProjectName, resourceType, resourceId, desired)
+	if err != nil {
+		return fmt.Errorf("error authorizing pipelines to use %s: %w", resourceName, err)
+	}
+
+	plan.done(step)
+
+	logger.Printf("Authorized %s to use %s\n", strings.Join(changes, ", "), resourceName)
+
+	return nil
+}
+
+// ensureEnvironmentChecks adds (or updates) the approval and business hours
+// checks of the environment. It is nil when the environment will be created
+func ensureEnvironmentChecks(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, plan *plan, dryRun bool, options *pipelineOptions, environmentName string, environment *services.AzDevopsEnvironmentInstance) error {
+	if len(options.approvers) == 0 && options.businessHours == nil {
+		return nil
+	}
+
+	var checks []services.AzDevopsCheckConfiguration
+	resource := services.AzDevopsCheckResource{
+		Type: services.PIPELINE_RESOURCE_TYPE_ENVIRONMENT,
+		Name: environmentName,
+	}
+	if environment != nil {
+		resource.Id = strconv.Itoa(environment.Id)
+
+		var err error
+		checks, err = azdevOps.ListCheckConfigurations(ctx, azDevOpsProjectName, resource.Type, resource.Id)
+		if err != nil {
+			return fmt.Errorf("error looking for checks of environment %s: %w", environmentName, err)
+		}
+	}
+
+	if len(options.approvers) > 0 {
+		approvers := make([]interface{}, 0, len(options.approvers))
+		approverIds := make([]string, 0, len(options.approvers))
+		for _, approver := range options.approvers {
+			identity, err := azdevOps.FindIdentity(ctx, approver)
+			if err != nil {
+				return fmt.Errorf("error looking for approver %s: %w", approver, err)
+			}
+
+			approvers = append(approvers, map[string]interface{}{"id": identity.Id})
+			approverIds = append(approverIds, identity.Id)
+		}
+
+		var current *services.AzDevopsCheckConfiguration
+		for i := range checks {
+			if strings.EqualFold(checks[i].Type.Id, services.CHECK_TYPE_APPROVAL_ID) {
+				current = &checks[i]
+				break
+			}
+		}
+
+		check := &services.AzDevopsCheckConfiguration{
+			Type: services.AzDevopsCheckType{Id: services.CHECK_TYPE_APPROVAL_ID, Name: "Approval"},
+			Settings: map[string]interface{}{
+				"approvers":                 approvers,
+				"executionOrder":            1,
+				"minRequiredApprovers":      0,
+				"instructions":              "",
+				"blockedApprovers":          []interface{}{},
+				"requesterCannotBeApprover": false,
+			},
+			Resource: resource,
+			Timeout:  approvalTimeout,
+		}
+
+		if current != nil && sameStrings(checkApproverIds(current), approverIds) {
+			plan.add("approval check", environmentName, planActionExists, "")
+			logger.Printf("Approval check of environment %s already exists\n", environmentName)
+		} else {
+			err := ensureCheck(ctx, azdevOps, azDevOpsProjectName, plan, dryRun, "approval check", environmentName, current, check, "approvers "+strings.Join(options.approvers, ", "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if options.businessHours != nil {
+		inputs := map[string]interface{}{
+			"businessDays": strings.Join(options.businessHours.days, ","),
+			"timeZone":     options.businessHours.timeZone,
+			"startTime":    options.businessHours.start,
+			"endTime":      options.businessHours.end,
+		}
+
+		var current *services.AzDevopsCheckConfiguration
+		for i := range checks {
+			definitionRef, _ := checks[i].Settings["definitionRef"].(map[string]interface{})
+			if strings.EqualFold(checks[i].Type.Id, services.CHECK_TYPE_TASK_ID) && definitionRef != nil && strings.EqualFold(fmt.Sprint(definitionRef["id"]), services.BUSINESS_HOURS_TASK_ID) {
+				current = &checks[i]
+				break
+			}
+		}
+
+		check := &services.AzDevopsCheckConfiguration{
+			Type: services.AzDevopsCheckType{Id: services.CHECK_TYPE_TASK_ID, Name: "Task Check"},
+			Settings: map[string]interface{}{
+				"definitionRef": map[string]interface{}{
+					"id":      services.BUSINESS_HOURS_TASK_ID,
+					"name":    "evaluatebusinesshours",
+					"version": "0.0.1",
+				},
+				"displayName":   "Business Hours",
+				"inputs":        inputs,
+				"retryInterval": 5,
+			},
+			Resource: resource,
+			Timeout:  businessHoursTimeout,
+		}
+
+		currentInputs := map[string]interface{}{}
+		if current != nil {
+			currentInputs, _ = current.Settings["inputs"].(map[string]interface{})
+		}
+
+		if current != nil && jsonEqual(currentInputs, inputs) {
+			plan.add("business hours check", environmentName, planActionExists, "")
+			logger.Printf("Business hours check of environment %s already exists\n", environmentName)
+		} else {
+			details := fmt.Sprintf("%s %s-%s %s", inputs["businessDays"], options.businessHours.start, options.businessHours.end, options.businessHours.timeZone)
+			err := ensureCheck(ctx, azdevOps, azDevOpsProjectName, plan, dryRun, "business hours check", environmentName, current, check, details)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ensureCheck creates the check or updates the current one with its settings
+func ensureCheck(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, plan *plan, dryRun bool, resource, environmentName string, current, check *services.AzDevopsCheckConfiguration, details string) error {
+	if current == nil {
+		step := plan.add(resource, environmentName, planActionCreate, details)
+		if dryRun {
+			return nil
+		}
+
+		_, err := azdevOps.CreateCheckConfiguration(ctx, azDevOpsProjectName, check)
+		if err != nil {
+			return fmt.Errorf("error creating %s of environment %s: %w", resource, environmentName, err)
+		}
+
+		plan.done(step)
+
+		logger.Printf("Created %s of environment %s\n", resource, environmentName)
+
+		return nil
+	}
+
+	step := plan.add(resource, environmentName, planActionUpdate, details)
+	if dryRun {
+		return nil
+	}
+
+	check.Id = current.Id
+	_, err := azdevOps.UpdateCheckConfiguration(ctx, azDevOpsProjectName, check)
+	if err != nil {
+		return fmt.Errorf("error updating %s of environment %s: %w", resource, environmentName, err)
+	}
+
+	plan.done(step)
+
+	logger.Printf("Updated %s of environment %s\n", resource, environmentName)
+
+	return nil
+}
+
+// jsonEqual compares two values as they are sent to Azure DevOps, so numbers
+// and nested maps decoded from a response match the ones built here
+func jsonEqual(a, b interface{}) bool {
+	normalizedA, err := normalizeJSON(a)
+	if err != nil {
+		return false
+	}
+
+	normalizedB, err := normalizeJSON(b)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(normalizedA, normalizedB)
+}
+
+// normalizeJSON encodes and decodes the value, which turns numbers into
+// float64 and structs into maps
+func normalizeJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	err = json.Unmarshal(data, &normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalized, nil
+}
+
+// checkApproverIds returns the identity ids of the approval check
+func checkApproverIds(check *services.AzDevopsCheckConfiguration) []string {
+	ids := []string{}
+	approvers, _ := check.Settings["approvers"].([]interface{})
+	for _, approver := range approvers {
+		if approverMap, ok := approver.(map[string]interface{}); ok {
+			ids = append(ids, fmt.Sprint(approverMap["id"]))
+		}
+	}
+
+	return ids
+}
+
+// sameStrings compares two lists ignoring order and case
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	lower := func(values []string) []string {
+		lowered := make([]string, 0, len(values))
+		for _, value := range values {
+			lowered = append(lowered, strings.ToLower(value))
+		}
+		sort.Strings(lowered)
+
+		return lowered
+	}
+
+	a, b = lower(a), lower(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
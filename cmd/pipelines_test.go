@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJsonEqual(t *testing.T) {
+	var decoded map[string]interface{}
+	err := json.Unmarshal([]byte(`{"timeZone":"UTC","days":[1,2],"window":{"start":8,"end":18}}`), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		a    interface{}
+		b    interface{}
+		want bool
+	}{
+		{name: "decoded response", a: decoded, b: map[string]interface{}{"timeZone": "UTC", "days": []int{1, 2}, "window": map[string]int{"start": 8, "end": 18}}, want: true},
+		{name: "struct", a: struct {
+			TimeZone string `json:"timeZone"`
+		}{TimeZone: "UTC"}, b: map[string]string{"timeZone": "UTC"}, want: true},
+		{name: "numbers", a: int64(1), b: 1.0, want: true},
+		{name: "different value", a: map[string]interface{}{"days": []int{1, 2}}, b: map[string]interface{}{"days": []int{1, 3}}, want: false},
+		{name: "different order", a: []int{1, 2}, b: []int{2, 1}, want: false},
+		{name: "missing key", a: map[string]int{"a": 1}, b: map[string]int{"a": 1, "b": 2}, want: false},
+		{name: "nil", a: nil, b: nil, want: true},
+		{name: "nil and empty", a: nil, b: map[string]int{}, want: false},
+		{name: "not encodable", a: func() {}, b: func() {}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := jsonEqual(test.a, test.b)
+			if got != test.want {
+				t.Errorf("jsonEqual() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/ericogr/azenv/services"
+)
+
+type planAction string
+
+const (
+	planActionCreate planAction = "create"
+	planActionUpdate planAction = "update"
+	planActionExists planAction = "exists"
+	planActionSkip   planAction = "skip"
+)
+
+// planState tells if a create or update step was done by a run
+type planState string
+
+const (
+	planStatePending    planState = "pending"
+	planStateDone       planState = "done"
+	planStateFailed     planState = "failed"
+	planStateRolledBack planState = "rolled back"
+)
+
+// planStep describes what would happen to a single resource
+type planStep struct {
+	resource string
+	name     string
+	action   planAction
+	details  string
+	state    planState
+}
+
+// planUndo removes the resource created by a step
+type planUndo struct {
+	step int
+	undo func(ctx context.Context) error
+}
+
+// plan collects the steps found during a dry-run or done by a run, and how
+// to undo the resources the run created
+type plan struct {
+	dryRun bool
+	steps  []planStep
+	undos  []planUndo
+}
+
+// add records a step and returns its index. Create and update steps stay
+// pending until done or created is called after the change succeeds
+func (p *plan) add(resource, name string, action planAction, details string) int {
+	state := planStateDone
+	if action == planActionCreate || action == planActionUpdate {
+		state = planStatePending
+	}
+
+	p.steps = append(p.steps, planStep{
+		resource: resource,
+		name:     name,
+		action:   action,
+		details:  details,
+		state:    state,
+	})
+
+	return len(p.steps) - 1
+}
+
+// done marks the change of the step as succeeded
+func (p *plan) done(step int) {
+	p.steps[step].state = planStateDone
+}
+
+// created marks the step as succeeded and records how to remove the resource
+// it created
+func (p *plan) created(step int, undo func(ctx context.Context) error) {
+	p.done(step)
+	p.undoable(step, undo)
+}
+
+// undoable records how to revert a change of the step, like recreating a
+// resource it deleted. It doesn't change the state of the step
+func (p *plan) undoable(step int, undo func(ctx context.Context) error) {
+	p.undos = append(p.undos, planUndo{step: step, undo: undo})
+}
+
+// fail marks the steps still pending as failed
+func (p *plan) fail() {
+	for i := range p.steps {
+		if p.steps[i].state == planStatePending {
+			p.steps[i].state = planStateFailed
+		}
+	}
+}
+
+// rollback reverts the changes of the run in reverse order, going on when one
+// of them fails. It returns what was reverted and what failed. A step is only
+// rolled back when every undo it recorded succeeded
+func (p *plan) rollback(ctx context.Context) (removed, failed []string) {
+	failedSteps := map[int]bool{}
+	revertedSteps := []int{}
+	for i := len(p.undos) - 1; i >= 0; i-- {
+		undo := p.undos[i]
+		step := p.steps[undo.step]
+		resource := step.resource + " " + step.name
+		err := undo.undo(ctx)
+		if err != nil && !errors.Is(err, services.ErrNotFound) {
+			logger.Printf("Error rolling back %s: %v\n", resource, err)
+			failedSteps[undo.step] = true
+			failed = append(failed, resource)
+			continue
+		}
+
+		logger.Printf("Rolled back %s\n", resource)
+		revertedSteps = append(revertedSteps, undo.step)
+		removed = append(removed, resource)
+	}
+	p.undos = nil
+
+	for _, step := range revertedSteps {
+		if !failedSteps[step] {
+			p.steps[step].state = planStateRolledBack
+		}
+	}
+
+	return removed, failed
+}
+
+// pendingChanges returns how many steps would create or update something
+func (p *plan) pendingChanges() int {
+	changes := 0
+	for _, step := range p.steps {
+		if step.action == planActionCreate || step.action == planActionUpdate {
+			changes++
+		}
+	}
+
+	return changes
+}
+
+// interrupted tells which step was in progress when the run was canceled or
+// timed out or, when none was, the last step done before it. A dry-run leaves
+// its steps pending, so it is always after the last one
+func (p *plan) interrupted(err error) error {
+	for i := len(p.steps) - 1; i >= 0 && !p.dryRun; i-- {
+		step := p.steps[i]
+		if step.state == planStatePending {
+			return fmt.Errorf("interrupted during step %s %s (%s): %w", step.resource, step.name, step.action, err)
+		}
+	}
+
+	if len(p.steps) == 0 {
+		return fmt.Errorf("interrupted before the first step: %w", err)
+	}
+
+	last := p.steps[len(p.steps)-1]
+
+	return fmt.Errorf("interrupted after step %s %s (%s): %w", last.resource, last.name, last.action, err)
+}
+
+// stepResult is a step in the -o json|yaml output
+type stepResult struct {
+	Resource string `json:"resource"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Details  string `json:"details,omitempty"`
+}
+
+var planActionStatus = map[planAction]string{
+	planActionCreate: "created",
+	planActionUpdate: "updated",
+	planActionExists: "existing",
+	planActionSkip:   "skipped",
+}
+
+// results lists the steps with their status. In a dry-run they are what would happen
+func (p *plan) results() []stepResult {
+	results := make([]stepResult, 0, len(p.steps))
+	for _, step := range p.steps {
+		status := planActionStatus[step.action]
+		if !p.dryRun && step.state != planStateDone {
+			status = string(step.state)
+		}
+
+		results = append(results, stepResult{
+			Resource: step.resource,
+			Name:     step.name,
+			Status:   status,
+			Details:  step.details,
+		})
+	}
+
+	return results
+}
+
+func (p *plan) print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tNAME\tACTION\tDETAILS")
+	for _, step := range p.steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.resource, step.name, step.action, step.details)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/ericogr/azenv/services"
+)
+
+func TestPlanStates(t *testing.T) {
+	tests := []struct {
+		name   string
+		action planAction
+		// record is what the run does after adding the step
+		record func(p *plan, step int)
+		want   planState
+	}{
+		{name: "exists", action: planActionExists, record: func(p *plan, step int) {}, want: planStateDone},
+		{name: "skip", action: planActionSkip, record: func(p *plan, step int) {}, want: planStateDone},
+		{name: "create pending", action: planActionCreate, record: func(p *plan, step int) {}, want: planStatePending},
+		{name: "update pending", action: planActionUpdate, record: func(p *plan, step int) {}, want: planStatePending},
+		{name: "update done", action: planActionUpdate, record: func(p *plan, step int) { p.done(step) }, want: planStateDone},
+		{name: "create created", action: planActionCreate, record: func(p *plan, step int) { p.created(step, nil) }, want: planStateDone},
+		{name: "create undoable", action: planActionCreate, record: func(p *plan, step int) { p.undoable(step, nil) }, want: planStatePending},
+		{name: "create failed", action: planActionCreate, record: func(p *plan, step int) { p.fail() }, want: planStateFailed},
+		{name: "done isn't failed", action: planActionCreate, record: func(p *plan, step int) { p.done(step); p.fail() }, want: planStateDone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &plan{}
+			p.add("resource", "first", planActionExists, "")
+			step := p.add("resource", "second", test.action, "")
+			if step != 1 {
+				t.Fatalf("got step %d, want 1", step)
+			}
+
+			test.record(p, step)
+			if p.steps[step].state != test.want {
+				t.Errorf("got state %q, want %q", p.steps[step].state, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanRollback(t *testing.T) {
+	logger = log.New(io.Discard, "", 0)
+	undone := []string{}
+	undo := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			undone = append(undone, name)
+			return err
+		}
+	}
+
+	p := &plan{}
+	namespace := p.add("namespace", "ns", planActionCreate, "")
+	p.created(namespace, undo("namespace", nil))
+	p.add("service account", "sa", planActionExists, "")
+	secret := p.add("secret", "sa-token", planActionCreate, "")
+	p.created(secret, undo("secret", services.ErrNotFound))
+	resource := p.add("environment resource", "ns", planActionCreate, "")
+	p.undoable(resource, undo("stale resource", nil))
+	p.created(resource, undo("new resource", errors.New("failed")))
+	endpoint := p.add("service connection", "sc", planActionCreate, "")
+	p.fail()
+
+	removed, failed := p.rollback(context.Background())
+
+	wantUndone := []string{"new resource", "stale resource", "secret", "namespace"}
+	if !reflect.DeepEqual(undone, wantUndone) {
+		t.Errorf("got undos %v, want %v", undone, wantUndone)
+	}
+
+	wantRemoved := []string{"environment resource ns", "secret sa-token", "namespace ns"}
+	if !reflect.DeepEqual(removed, wantRemoved) {
+		t.Errorf("got removed %v, want %v", removed, wantRemoved)
+	}
+
+	wantFailed := []string{"environment resource ns"}
+	if !reflect.DeepEqual(failed, wantFailed) {
+		t.Errorf("got failed %v, want %v", failed, wantFailed)
+	}
+
+	wantStates := map[int]planState{
+		namespace: planStateRolledBack,
+		1:         planStateDone,
+		secret:    planStateRolledBack,
+		// one of its undos failed
+		resource: planStateDone,
+		endpoint: planStateFailed,
+	}
+	for step, want := range wantStates {
+		if p.steps[step].state != want {
+			t.Errorf("got step %d state %q, want %q", step, p.steps[step].state, want)
+		}
+	}
+
+	removed, failed = p.rollback(context.Background())
+	if len(removed) != 0 || len(failed) != 0 {
+		t.Errorf("got removed %v and failed %v rolling back twice, want nothing", removed, failed)
+	}
+}
+
+func TestPlanInterrupted(t *testing.T) {
+	canceled := context.Canceled
+
+	tests := []struct {
+		name  string
+		steps func(p *plan)
+		want  string
+	}{
+		{name: "no steps", steps: func(p *plan) {}, want: "interrupted before the first step: context canceled"},
+		{
+			name: "pending step",
+			steps: func(p *plan) {
+				p.add("namespace", "ns", planActionExists, "")
+				p.add("secret", "sa-token", planActionCreate, "")
+				p.add("service connection", "sc", planActionCreate, "")
+			},
+			want: "interrupted during step service connection sc (create): context canceled",
+		},
+		{
+			name: "after the last step",
+			steps: func(p *plan) {
+				p.done(p.add("secret", "sa-token", planActionCreate, ""))
+				p.add("service account", "sa", planActionExists, "")
+			},
+			want: "interrupted after step service account sa (exists): context canceled",
+		},
+		{
+			name: "dry-run",
+			steps: func(p *plan) {
+				p.dryRun = true
+				p.add("secret", "sa-token", planActionCreate, "")
+				p.add("service connection", "sc", planActionCreate, "")
+			},
+			want: "interrupted after step service connection sc (create): context canceled",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &plan{}
+			test.steps(p)
+
+			err := p.interrupted(canceled)
+			if err.Error() != test.want {
+				t.Errorf("got %q, want %q", err, test.want)
+			}
+			if !errors.Is(err, canceled) {
+				t.Errorf("got %v, want it to wrap %v", err, canceled)
+			}
+		})
+	}
+}
+
+func TestPlanResults(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry-run %v", dryRun), func(t *testing.T) {
+			p := &plan{dryRun: dryRun}
+			p.add("namespace", "ns", planActionExists, "")
+			p.done(p.add("secret", "sa-token", planActionCreate, ""))
+			p.add("role binding", "sa", planActionUpdate, "+role")
+			p.add("service connection", "sc", planActionSkip, "")
+
+			want := []string{"existing", "created", "updated", "skipped"}
+			if !dryRun {
+				want[2] = "pending"
+			}
+
+			for i, result := range p.results() {
+				if result.Status != want[i] {
+					t.Errorf("got step %d status %q, want %q", i, result.Status, want[i])
+				}
+			}
+			if p.pendingChanges() != 2 {
+				t.Errorf("got %d pending changes, want 2", p.pendingChanges())
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ericogr/azenv/services"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// ensureServiceAccountRole binds the role to the service account inside its
+// namespace. Presets create (or update) a Role with the preset rules, any
+// other name must be an existing ClusterRole
+func ensureServiceAccountRole(ctx context.Context, kubernetes *services.Kubernetes, plan *plan, dryRun bool, namespaceName, serviceAccountName, role string) error {
+	var roleRef rbacv1.RoleRef
+	rules, isPreset := services.RolePresets[role]
+	if isPreset {
+		roleName := services.ROLE_PRESET_PREFIX + role
+		roleRef = rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     roleName,
+		}
+
+		k8sRole, err := kubernetes.GetRole(ctx, namespaceName, roleName)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error looking for role %s/%s: %w", namespaceName, roleName, err)
+		}
+
+		if k8sRole == nil {
+			step := plan.add("role", namespaceName+"/"+roleName, planActionCreate, "preset "+role)
+			if !dryRun {
+				_, err = kubernetes.CreateRole(ctx, namespaceName, roleName, rules)
+				if err != nil {
+					return fmt.Errorf("error creating role %s/%s: %w", namespaceName, roleName, err)
+				}
+
+				plan.created(step, func(ctx context.Context) error {
+					return kubernetes.DeleteRole(ctx, namespaceName, roleName)
+				})
+
+				logger.Printf("Kubernetes role %s/%s created\n", namespaceName, roleName)
+			}
+		} else if !equality.Semantic.DeepEqual(k8sRole.Rules, rules) {
+			step := plan.add("role", namespaceName+"/"+roleName, planActionUpdate, "rules differ from preset "+role)
+			if !dryRun {
+				k8sRole.Rules = rules
+				_, err = kubernetes.UpdateRole(ctx, k8sRole)
+				if err != nil {
+					return fmt.Errorf("error updating role %s/%s: %w", namespaceName, roleName, err)
+				}
+
+				plan.done(step)
+
+				logger.Printf("Kubernetes role %s/%s updated\n", namespaceName, roleName)
+			}
+		} else {
+			plan.add("role", namespaceName+"/"+roleName, planActionExists, "")
+			logger.Printf("Kubernetes role %s/%s already exists\n", namespaceName, roleName)
+		}
+	} else {
+		_, err := kubernetes.GetClusterRole(ctx, role)
+		if err != nil {
+			return fmt.Errorf("error looking for cluster role %s (presets are %s, %s and %s): %w", role, services.ROLE_PRESET_NAMESPACE_ADMIN, services.ROLE_PRESET_DEPLOYER, services.ROLE_PRESET_READ_ONLY, err)
+		}
+
+		roleRef = rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     role,
+		}
+	}
+
+	roleBindingName := fmt.Sprintf("%s-%s", serviceAccountName, roleRef.Name)
+	roleBinding, err := kubernetes.GetRoleBinding(ctx, namespaceName, roleBindingName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for role binding %s/%s: %w", namespaceName, roleBindingName, err)
+	}
+
+	if roleBinding == nil {
+		step := plan.add("role binding", namespaceName+"/"+roleBindingName, planActionCreate, fmt.Sprintf("%s %s", roleRef.Kind, roleRef.Name))
+		if !dryRun {
+			_, err = kubernetes.CreateRoleBinding(ctx, namespaceName, roleBindingName, roleRef, serviceAccountName)
+			if err != nil {
+				return fmt.Errorf("error creating role binding %s/%s: %w", namespaceName, roleBindingName, err)
+			}
+
+			plan.created(step, func(ctx context.Context) error {
+				return kubernetes.DeleteRoleBinding(ctx, namespaceName, roleBindingName)
+			})
+
+			logger.Printf("Kubernetes role binding %s/%s created\n", namespaceName, roleBindingName)
+		}
+
+		return nil
+	}
+
+	// the role of a binding can't be changed
+	if roleBinding.RoleRef != roleRef {
+		return fmt.Errorf("role binding %s/%s already exists but references %s %s", namespaceName, roleBindingName, roleBinding.RoleRef.Kind, roleBinding.RoleRef.Name)
+	}
+
+	for _, subject := range roleBinding.Subjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Name == serviceAccountName && subject.Namespace == namespaceName {
+			plan.add("role binding", namespaceName+"/"+roleBindingName, planActionExists, "")
+			logger.Printf("Kubernetes role binding %s/%s already exists\n", namespaceName, roleBindingName)
+
+			return nil
+		}
+	}
+
+	step := plan.add("role binding", namespaceName+"/"+roleBindingName, planActionUpdate, "add service account "+serviceAccountName)
+	if dryRun {
+		return nil
+	}
+
+	roleBinding.Subjects = append(roleBinding.Subjects, rbacv1.Subject{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      serviceAccountName,
+		Namespace: namespaceName,
+	})
+	_, err = kubernetes.UpdateRoleBinding(ctx, roleBinding)
+	if err != nil {
+		return fmt.Errorf("error updating role binding %s/%s: %w", namespaceName, roleBindingName, err)
+	}
+
+	plan.done(step)
+
+	logger.Printf("Kubernetes role binding %s/%s updated\n", namespaceName, roleBindingName)
+
+	return nil
+}
+
+// deleteServiceAccountRoles removes the role bindings created for the service
+// account by ensureServiceAccountRole and the preset roles no other binding of
+// the namespace references. A binding with other subjects only loses the
+// service account
+func deleteServiceAccountRoles(ctx context.Context, kubernetes *services.Kubernetes, namespaceName, serviceAccountName string) error {
+	roleBindings, err := kubernetes.ListRoleBindings(ctx, namespaceName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for role bindings of namespace %s: %w", namespaceName, err)
+	}
+
+	presetRoles := map[string]bool{}
+	referencedRoles := map[string]bool{}
+	for i := range roleBindings {
+		roleBinding := &roleBindings[i]
+		roleRef := roleBinding.RoleRef
+		subjects := []rbacv1.Subject{}
+		for _, subject := range roleBinding.Subjects {
+			if subject.Kind != rbacv1.ServiceAccountKind || subject.Name != serviceAccountName || subject.Namespace != namespaceName {
+				subjects = append(subjects, subject)
+			}
+		}
+
+		if roleBinding.Name != fmt.Sprintf("%s-%s", serviceAccountName, roleRef.Name) || len(subjects) == len(roleBinding.Subjects) {
+			if roleRef.Kind == "Role" {
+				referencedRoles[roleRef.Name] = true
+			}
+			continue
+		}
+
+		if roleRef.Kind == "Role" && strings.HasPrefix(roleRef.Name, services.ROLE_PRESET_PREFIX) {
+			presetRoles[roleRef.Name] = true
+		}
+
+		if len(subjects) > 0 {
+			if roleRef.Kind == "Role" {
+				referencedRoles[roleRef.Name] = true
+			}
+
+			roleBinding.Subjects = subjects
+			_, err = kubernetes.UpdateRoleBinding(ctx, roleBinding)
+			if err != nil {
+				return fmt.Errorf("error updating role binding %s/%s: %w", namespaceName, roleBinding.Name, err)
+			}
+
+			logger.Printf("Kubernetes service account %s removed from role binding %s/%s\n", serviceAccountName, namespaceName, roleBinding.Name)
+			continue
+		}
+
+		err = kubernetes.DeleteRoleBinding(ctx, namespaceName, roleBinding.Name)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error deleting role binding %s/%s: %w", namespaceName, roleBinding.Name, err)
+		}
+
+		logger.Printf("Kubernetes role binding %s/%s deleted\n", namespaceName, roleBinding.Name)
+	}
+
+	for roleName := range presetRoles {
+		if referencedRoles[roleName] {
+			logger.Printf("Kubernetes role %s/%s still has role bindings, keeping it\n", namespaceName, roleName)
+			continue
+		}
+
+		err = kubernetes.DeleteRole(ctx, namespaceName, roleName)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error deleting role %s/%s: %w", namespaceName, roleName, err)
+		}
+
+		logger.Printf("Kubernetes role %s/%s deleted\n", namespaceName, roleName)
+	}
+
+	return nil
+}
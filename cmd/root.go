@@ -1,19 +1,24 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
 
 var logger *log.Logger
+var cancelTimeout context.CancelFunc = func() {}
 var rootCmd = &cobra.Command{
-	PreRun: toggleDebug,
-	Use:    "azenv",
-	Short:  "AzureDevOps Environment Management",
+	PreRun:            toggleDebug,
+	PersistentPreRunE: applyTimeout,
+	Use:               "azenv",
+	Short:             "AzureDevOps Environment Management",
 	Long: `This tool can manage Azure DevOps environments (for now, only Kubernetes is supported)
 
 Example:
@@ -49,8 +54,50 @@ func toggleDebug(cmd *cobra.Command, args []string) {
 	}
 }
 
+// applyTimeout limits the whole command to --timeout
+func applyTimeout(cmd *cobra.Command, args []string) error {
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+
+	if timeout < 0 {
+		return fmt.Errorf("invalid timeout %s, it can't be negative", timeout)
+	}
+
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancelTimeout = context.WithTimeout(cmd.Context(), timeout)
+		cmd.SetContext(ctx)
+	}
+
+	return nil
+}
+
+// Execute runs the command until it finishes or Ctrl-C cancels the in-flight
+// Azure DevOps and Kubernetes requests. A second Ctrl-C terminates right away
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		if logger != nil {
+			logger.Println("Interrupted, canceling the requests in progress")
+		}
+		cancel()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	cancelTimeout()
+	cancel()
+
+	if interrupted {
+		os.Exit(130)
+	}
+
 	if err != nil {
 		os.Exit(1)
 	}
@@ -58,4 +105,8 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().Bool("quiet", false, "Only show output when errors are found")
+	rootCmd.PersistentFlags().String("kubeconfig", "", "[default=KUBECONFIG or ~/.kube/config] Kubeconfig file of the Kubernetes cluster")
+	rootCmd.PersistentFlags().String("context", "", "[default=current context] Kubeconfig context of the Kubernetes cluster")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "[default=0] Time limit of the whole command, 0 means no limit")
+	rootCmd.PersistentFlags().String("cluster-server", "", "[default=server of the context] Kubernetes API server URL, overriding the one of the kubeconfig context")
 }
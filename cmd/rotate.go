@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// rotateCmd represents the rotate command
+var rotateCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "rotate",
+	Short:  "Rotate service connection credentials",
+	Long:   `Use this command to refresh the credentials of an existing AzureDevOps service connection`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Println("Error: must also specify a resource like kubernetes")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateCmd)
+
+	rotateCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
+	err := rotateCmd.MarkPersistentFlagRequired("project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	rotateCmd.PersistentFlags().StringP("service-connection", "c", "", "[required] AzureDevOps service connection name")
+	err = rotateCmd.MarkPersistentFlagRequired("service-connection")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addAzDevOpsFlags(rotateCmd.PersistentFlags())
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+// rotateKubernetesCmd represents the rotate kubernetes command
+var rotateKubernetesCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "kubernetes",
+	Short:  "Rotate a Kubernetes service connection token",
+	Long:   `Use this command to issue a new service account token and update an existing AzureDevOps Kubernetes service connection with it`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		serviceConnection, err := cmd.Flags().GetString("service-connection")
+		if err != nil {
+			return err
+		}
+
+		serviceAccount, err := cmd.Flags().GetString("service-account")
+		if err != nil {
+			return err
+		}
+
+		showKubeconfig, err := cmd.Flags().GetBool("show-kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		tokenMode, err := cmd.Flags().GetString("token-mode")
+		if err != nil {
+			return err
+		}
+
+		err = validateTokenMode(tokenMode)
+		if err != nil {
+			return err
+		}
+
+		tokenTTL, err := cmd.Flags().GetDuration("token-ttl")
+		if err != nil {
+			return err
+		}
+
+		acceptUntrustedCerts, err := cmd.Flags().GetBool("accept-untrusted-certs")
+		if err != nil {
+			return err
+		}
+
+		kubernetes, err := getKubernetes(cmd)
+		if err != nil {
+			return err
+		}
+
+		return rotateKubernetes(cmd.Context(), azDevOpsSettings, kubernetes, organizationProject, serviceAccount, serviceConnection, tokenMode, tokenTTL, showKubeconfig, acceptUntrustedCerts)
+	},
+}
+
+func init() {
+	rotateCmd.AddCommand(rotateKubernetesCmd)
+
+	rotateKubernetesCmd.Flags().StringP("service-account", "a", "", "[required] Kubernetes service account name with namespace (ex: namespace/service-account-name)")
+	err := rotateKubernetesCmd.MarkFlagRequired("service-account")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	rotateKubernetesCmd.Flags().Bool("show-kubeconfig", false, "[default=false] Show kubernetes kubeconfig created with the new token")
+	rotateKubernetesCmd.Flags().String("token-mode", tokenModeSecret, "[default=secret] How the new service account token is issued: secret (create a new token secret) or tokenrequest (bound token with expiration)")
+	rotateKubernetesCmd.Flags().Duration("token-ttl", defaultTokenTTL, "[default=8760h] Token duration when token-mode is tokenrequest")
+	addAcceptUntrustedCertsFlag(rotateKubernetesCmd.Flags())
+}
+
+func rotateKubernetes(ctx context.Context, azDevOpsSettings *azDevOpsSettings, kubernetes *services.Kubernetes, azDevOpsOrgProjectName, namespaceServiceAccountName, serviceConnectionName, tokenMode string, tokenTTL time.Duration, showKubeconfig, acceptUntrustedCerts bool) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	namespaceName, serviceAccountName, err := splitNamespaceServiceAccount(namespaceServiceAccountName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+
+	serviceConnection, err := azdevOps.FindServiceEndpoint(ctx, azDevOpsProjectName, serviceConnectionName)
+	if err != nil {
+		return fmt.Errorf("error looking for service connection %s: %w", serviceConnectionName, err)
+	}
+
+	// workload identity federation doesn't store any token
+	authorizationType, _ := serviceConnection.Data["authorizationType"].(string)
+	if authorizationType == services.AUTHORIZATION_TYPE_AZURE_SUBSCRIPTION {
+		return fmt.Errorf("service connection %s uses workload identity federation, there is no token to rotate", serviceConnectionName)
+	}
+
+	_, err = kubernetes.GetServiceAccount(ctx, namespaceName, serviceAccountName)
+	if err != nil {
+		return fmt.Errorf("error looking for service account %s/%s: %w", namespaceName, serviceAccountName, err)
+	}
+
+	// the old secrets are only deleted once the service connection uses the
+	// new token, since deleting a secret revokes its token. Their tokens never
+	// expire, so they are deleted whatever the token mode is
+	oldSecrets, err := serviceAccountTokenSecrets(ctx, kubernetes, namespaceName, serviceAccountName)
+	if err != nil {
+		return err
+	}
+
+	var secret *v1.Secret
+	if tokenMode == tokenModeSecret {
+		secretName := fmt.Sprintf("%s-%d", serviceAccountSecretName(serviceAccountName), time.Now().Unix())
+		secret, err = kubernetes.CreateSecret(ctx, namespaceName, secretName, serviceAccountName)
+		if err != nil {
+			return fmt.Errorf("error creating secret for service account %s: %w", serviceAccountName, err)
+		}
+
+		logger.Printf("Kubernetes secret %s/%s created\n", namespaceName, secretName)
+	}
+
+	err = updateServiceConnectionToken(ctx, azdevOps, kubernetes, serviceConnection, authorizationType, namespaceName, serviceAccountName, secret, tokenMode, tokenTTL, showKubeconfig, acceptUntrustedCerts)
+	if err != nil {
+		if secret != nil {
+			// the command may be canceled, the new secret is removed anyway
+			deleteErr := kubernetes.DeleteSecret(context.WithoutCancel(ctx), namespaceName, secret.Name)
+			if services.IgnoreResourceNotFoundError(deleteErr) != nil {
+				logger.Printf("Error deleting secret %s/%s: %v\n", namespaceName, secret.Name, deleteErr)
+			} else {
+				logger.Printf("Kubernetes secret %s/%s deleted, the service connection keeps the old token\n", namespaceName, secret.Name)
+			}
+		}
+
+		return err
+	}
+
+	logger.Printf("Service connection %s updated with the new token\n", serviceConnectionName)
+
+	for _, oldSecret := range oldSecrets {
+		err = kubernetes.DeleteSecret(ctx, namespaceName, oldSecret.Name)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error deleting old secret %s/%s: %w", namespaceName, oldSecret.Name, err)
+		}
+
+		logger.Printf("Kubernetes secret %s/%s deleted\n", namespaceName, oldSecret.Name)
+	}
+
+	// token secrets with other names weren't created by this tool
+	secrets, err := kubernetes.ListServiceAccountTokenSecrets(ctx, namespaceName, serviceAccountName)
+	if err != nil {
+		return fmt.Errorf("error looking for token secrets of service account %s/%s: %w", namespaceName, serviceAccountName, err)
+	}
+
+	for _, leftSecret := range secrets {
+		if !isServiceAccountSecretName(serviceAccountName, leftSecret.Name) {
+			logger.Printf("Warning: Kubernetes secret %s/%s still holds a token of service account %s, delete it to revoke that token\n", namespaceName, leftSecret.Name, serviceAccountName)
+		}
+	}
+
+	return nil
+}
+
+// updateServiceConnectionToken gets a token of the service account and
+// stores it in the service connection, keeping its authorization type
+func updateServiceConnectionToken(ctx context.Context, azdevOps *services.AzDevOps, kubernetes *services.Kubernetes, serviceConnection *services.AzDevopsServiceEndpoint, authorizationType, namespaceName, serviceAccountName string, secret *v1.Secret, tokenMode string, tokenTTL time.Duration, showKubeconfig, acceptUntrustedCerts bool) error {
+	token, err := getServiceAccountToken(ctx, kubernetes, namespaceName, serviceAccountName, secret, tokenMode, tokenTTL)
+	if err != nil {
+		return err
+	}
+
+	authType := authTypeKubeconfig
+	if authorizationType == services.AUTHORIZATION_TYPE_SERVICE_ACCOUNT {
+		authType = authTypeServiceAccount
+	}
+
+	credentials, err := newEndpointCredentials(kubernetes, authType, namespaceName, serviceAccountName, token, showKubeconfig, acceptUntrustedCerts)
+	if err != nil {
+		return err
+	}
+
+	serviceConnection.Description = serviceConnectionDescription("Rotated", token)
+	serviceConnection.URL = credentials.URL
+	if serviceConnection.Data == nil {
+		serviceConnection.Data = map[string]interface{}{}
+	}
+	for k, v := range credentials.Data {
+		serviceConnection.Data[k] = v
+	}
+	serviceConnection.Authorization = credentials.Authorization
+	_, err = azdevOps.UpdateServiceEndpoint(ctx, serviceConnection)
+	if err != nil {
+		return fmt.Errorf("error updating service connection %s: %w", serviceConnection.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// securityRoles lists the identities (accounts, group names or descriptors) of each role
+type securityRoles map[string][]string
+
+// securityOptions are the role assignments of the environment and of the service connections
+type securityOptions struct {
+	environment       securityRoles
+	serviceConnection securityRoles
+}
+
+var securityRoleFlags = map[string]string{
+	"admin":  services.SECURITY_ROLE_ADMINISTRATOR,
+	"user":   services.SECURITY_ROLE_USER,
+	"reader": services.SECURITY_ROLE_READER,
+}
+
+func addSecurityRoleFlags(flags *pflag.FlagSet) {
+	for _, resource := range []string{"environment", "service-connection"} {
+		for flag, role := range securityRoleFlags {
+			flags.StringArray(fmt.Sprintf("%s-%s", resource, flag), nil, fmt.Sprintf("[default=] Assign the %s role of the %s to a user or group (account, group name like [project]\\Contributors or descriptor). Can be repeated", role, strings.ReplaceAll(resource, "-", " ")))
+		}
+	}
+}
+
+func getSecurityRoleFlags(cmd *cobra.Command) (*securityOptions, error) {
+	options := &securityOptions{
+		environment:       securityRoles{},
+		serviceConnection: securityRoles{},
+	}
+
+	for flag, role := range securityRoleFlags {
+		identities, err := cmd.Flags().GetStringArray("environment-" + flag)
+		if err != nil {
+			return nil, err
+		}
+		if len(identities) > 0 {
+			options.environment[role] = identities
+		}
+
+		identities, err = cmd.Flags().GetStringArray("service-connection-" + flag)
+		if err != nil {
+			return nil, err
+		}
+		if len(identities) > 0 {
+			options.serviceConnection[role] = identities
+		}
+	}
+
+	return options, nil
+}
+
+// ensureSecurityRoles assigns the roles of the environment and of the service connections
+func ensureSecurityRoles(ctx context.Context, azdevOps *services.AzDevOps, azDevOpsProjectName string, plan *plan, options createKubernetesOptions, environment *services.AzDevopsEnvironmentInstance, serviceConnections []*services.AzDevopsServiceEndpoint) error {
+	if options.security == nil || (len(options.security.environment) == 0 && len(options.security.serviceConnection) == 0) {
+		return nil
+	}
+
+	project, err := azdevOps.FindProject(ctx, azDevOpsProjectName)
+	if err != nil {
+		return fmt.Errorf("error looking for Azure DevOps project %s: %w", azDevOpsProjectName, err)
+	}
+
+	environmentId := ""
+	if environment != nil {
+		environmentId = strconv.Itoa(environment.Id)
+	}
+
+	err = ensureRoleAssignments(ctx, azdevOps, plan, options.dryRun, services.SECURITY_ROLE_SCOPE_ENVIRONMENT, project.ID, environmentId, "environment "+options.environmentName, options.security.environment)
+	if err != nil {
+		return err
+	}
+
+	for i, target := range options.targets {
+		serviceConnectionId := ""
+		if serviceConnections[i] != nil {
+			serviceConnectionId = serviceConnections[i].Id
+		}
+
+		err = ensureRoleAssignments(ctx, azdevOps, plan, options.dryRun, services.SECURITY_ROLE_SCOPE_SERVICE_ENDPOINT, project.ID, serviceConnectionId, "service connection "+target.serviceConnectionName, options.security.serviceConnection)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureRoleAssignments assigns the roles to the identities that don't have
+// them yet. An empty resource id means the resource will be created by this run
+func ensureRoleAssignments(ctx context.Context, azdevOps *services.AzDevOps, plan *plan, dryRun bool, scopeId, projectId, resourceId, resourceName string, roles securityRoles) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	currentRoles := map[string]string{}
+	if resourceId != "" {
+		assignments, err := azdevOps.ListRoleAssignments(ctx, scopeId, services.SecurityRoleResourceId(projectId, resourceId))
+		if err != nil {
+			return fmt.Errorf("error looking for role assignments of %s: %w", resourceName, err)
+		}
+
+		for _, assignment := range assignments {
+			currentRoles[strings.ToLower(assignment.Identity.Id)] = assignment.Role.Name
+		}
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	for role := range roles {
+		roleNames = append(roleNames, role)
+	}
+	sort.Strings(roleNames)
+
+	requests := []services.AzDevopsRoleAssignmentRequest{}
+	changes := []string{}
+	for _, role := range roleNames {
+		for _, account := range roles[role] {
+			identity, err := azdevOps.FindIdentity(ctx, account)
+			if err != nil {
+				return fmt.Errorf("error looking for identity %s: %w", account, err)
+			}
+
+			if currentRoles[strings.ToLower(identity.Id)] == role {
+				continue
+			}
+
+			requests = append(requests, services.AzDevopsRoleAssignmentRequest{
+				UserId:   identity.Id,
+				RoleName: role,
+			})
+			changes = append(changes, fmt.Sprintf("%s %s", role, account))
+		}
+	}
+
+	if len(requests) == 0 {
+		plan.add("role assignments", resourceName, planActionExists, "")
+		logger.Printf("Role assignments of %s already exist\n", resourceName)
+
+		return nil
+	}
+
+	step := plan.add("role assignments", resourceName, planActionUpdate, strings.Join(changes, ", "))
+	if dryRun {
+		return nil
+	}
+
+	err := azdevOps.SetRoleAssignments(ctx, scopeId, services.SecurityRoleResourceId(projectId, resourceId), requests)
+	if err != nil {
+		return fmt.Errorf("error assigning roles of %s: %w", resourceName, err)
+	}
+
+	plan.done(step)
+
+	logger.Printf("Assigned roles of %s: %s\n", resourceName, strings.Join(changes, ", "))
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// shareCmd represents the share command
+var shareCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "share",
+	Short:  "Share a resource with other projects",
+	Long:   `Use this command to share an AzureDevOps resource with other projects of the organization`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Println("Error: must also specify a resource like service-connection")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shareCmd)
+
+	shareCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
+	err := shareCmd.MarkPersistentFlagRequired("project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addAzDevOpsFlags(shareCmd.PersistentFlags())
+}
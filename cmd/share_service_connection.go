@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+)
+
+// shareServiceConnectionCmd represents the share service-connection command
+var shareServiceConnectionCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "service-connection",
+	Short:  "Share a service connection with other projects",
+	Long:   `Use this command to add project references to an existing AzureDevOps service connection, so other projects can use it`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		serviceConnection, err := cmd.Flags().GetString("service-connection")
+		if err != nil {
+			return err
+		}
+
+		projects, err := cmd.Flags().GetStringArray("with-project")
+		if err != nil {
+			return err
+		}
+
+		return shareServiceConnection(cmd.Context(), azDevOpsSettings, organizationProject, serviceConnection, projects)
+	},
+}
+
+func init() {
+	shareCmd.AddCommand(shareServiceConnectionCmd)
+
+	shareServiceConnectionCmd.Flags().StringP("service-connection", "c", "", "[required] AzureDevOps service connection name")
+	err := shareServiceConnectionCmd.MarkFlagRequired("service-connection")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	shareServiceConnectionCmd.Flags().StringArray("with-project", nil, "[required] Project of the same organization to share the service connection with. Can be repeated")
+	err = shareServiceConnectionCmd.MarkFlagRequired("with-project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+}
+
+func shareServiceConnection(ctx context.Context, azDevOpsSettings *azDevOpsSettings, azDevOpsOrgProjectName, serviceConnectionName string, projects []string) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+	serviceConnection, err := azdevOps.FindServiceEndpoint(ctx, azDevOpsProjectName, serviceConnectionName)
+	if err != nil {
+		return fmt.Errorf("error looking for service connection %s: %w", serviceConnectionName, err)
+	}
+
+	return ensureServiceConnectionShared(ctx, azdevOps, &plan{}, false, serviceConnectionName, serviceConnection, projects)
+}
+
+// ensureServiceConnectionShared adds the projects missing from the service
+// connection references. The service connection is nil when it will be created
+func ensureServiceConnectionShared(ctx context.Context, azdevOps *services.AzDevOps, plan *plan, dryRun bool, serviceConnectionName string, serviceConnection *services.AzDevopsServiceEndpoint, projects []string) error {
+	if len(projects) == 0 {
+		return nil
+	}
+
+	shared := map[string]bool{}
+	if serviceConnection != nil {
+		for _, reference := range serviceConnection.AzServiceEndpointProjectReferences {
+			shared[strings.ToLower(reference.AzureDevopsProjectReference.Id)] = true
+			shared[strings.ToLower(reference.AzureDevopsProjectReference.Name)] = true
+		}
+	}
+
+	references := []services.AzServiceEndpointProjectReferences{}
+	missing := []string{}
+	missingIds := []string{}
+	for _, projectName := range projects {
+		project, err := azdevOps.FindProject(ctx, projectName)
+		if err != nil {
+			return fmt.Errorf("error looking for Azure DevOps project %s: %w", projectName, err)
+		}
+
+		if shared[strings.ToLower(project.ID)] || shared[strings.ToLower(project.Name)] {
+			continue
+		}
+
+		description := ""
+		if serviceConnection != nil {
+			description = serviceConnection.Description
+		}
+
+		references = append(references, services.AzServiceEndpointProjectReferences{
+			Name:        serviceConnectionName,
+			Description: description,
+			AzureDevopsProjectReference: services.AzDevopsProjectReference{
+				Id:   project.ID,
+				Name: project.Name,
+			},
+		})
+		missing = append(missing, project.Name)
+		missingIds = append(missingIds, project.ID)
+	}
+
+	if len(references) == 0 {
+		plan.add("service connection sharing", serviceConnectionName, planActionExists, "")
+		logger.Printf("Service connection %s already shared with %s\n", serviceConnectionName, strings.Join(projects, ", "))
+
+		return nil
+	}
+
+	step := plan.add("service connection sharing", serviceConnectionName, planActionUpdate, "share with "+strings.Join(missing, ", "))
+	if dryRun || serviceConnection == nil {
+		return nil
+	}
+
+	err := azdevOps.ShareServiceEndpoint(ctx, serviceConnection.Id, references)
+	if err != nil {
+		return fmt.Errorf("error sharing service connection %s: %w", serviceConnectionName, err)
+	}
+
+	// removing the service connection from a project it is shared with only unshares it
+	serviceConnectionId := serviceConnection.Id
+	plan.done(step)
+	plan.undoable(step, func(ctx context.Context) error {
+		return azdevOps.DeleteServiceEndpoint(ctx, serviceConnectionId, missingIds)
+	})
+
+	logger.Printf("Service connection %s shared with %s\n", serviceConnectionName, strings.Join(missing, ", "))
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericogr/azenv/services"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	tokenModeSecret       = "secret"
+	tokenModeTokenRequest = "tokenrequest"
+	defaultTokenTTL       = 365 * 24 * time.Hour
+
+	// tokenExpirationMarker prefixes the expiration recorded in the service
+	// connection description, so rotation jobs can find it
+	tokenExpirationMarker = "token-expiration="
+)
+
+// serviceAccountToken is a token used by the service connection. Expiration
+// is nil for legacy token secrets, which also carry the cluster CA
+type serviceAccountToken struct {
+	token      string
+	ca         []byte
+	expiration *time.Time
+}
+
+func validateTokenMode(tokenMode string) error {
+	if tokenMode != tokenModeSecret && tokenMode != tokenModeTokenRequest {
+		return fmt.Errorf("invalid token-mode %s, please use %s or %s", tokenMode, tokenModeSecret, tokenModeTokenRequest)
+	}
+
+	return nil
+}
+
+// serviceAccountTokenSecrets returns the token secrets of the service account
+// named by this tool, <sa>-token or <sa>-token-<suffix> after a rotation,
+// oldest first
+func serviceAccountTokenSecrets(ctx context.Context, kubernetes *services.Kubernetes, namespaceName, serviceAccountName string) ([]v1.Secret, error) {
+	secrets, err := kubernetes.ListServiceAccountTokenSecrets(ctx, namespaceName, serviceAccountName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for token secrets of service account %s/%s: %w", namespaceName, serviceAccountName, err)
+	}
+
+	tokenSecrets := []v1.Secret{}
+	for _, secret := range secrets {
+		if isServiceAccountSecretName(serviceAccountName, secret.Name) {
+			tokenSecrets = append(tokenSecrets, secret)
+		}
+	}
+
+	sort.Slice(tokenSecrets, func(i, j int) bool {
+		if tokenSecrets[i].CreationTimestamp.Equal(&tokenSecrets[j].CreationTimestamp) {
+			return tokenSecrets[i].Name < tokenSecrets[j].Name
+		}
+
+		return tokenSecrets[i].CreationTimestamp.Before(&tokenSecrets[j].CreationTimestamp)
+	})
+
+	return tokenSecrets, nil
+}
+
+// isServiceAccountSecretName tells if the secret has a name given by this
+// tool to a token secret of the service account
+func isServiceAccountSecretName(serviceAccountName, name string) bool {
+	secretName := serviceAccountSecretName(serviceAccountName)
+
+	return name == secretName || strings.HasPrefix(name, secretName+"-")
+}
+
+// currentServiceAccountSecretName returns the newest token secret of the
+// service account, or the name given by create kubernetes when there is none
+func currentServiceAccountSecretName(ctx context.Context, kubernetes *services.Kubernetes, namespaceName, serviceAccountName string) (string, error) {
+	secrets, err := serviceAccountTokenSecrets(ctx, kubernetes, namespaceName, serviceAccountName)
+	if err != nil {
+		return "", err
+	}
+
+	if len(secrets) == 0 {
+		return serviceAccountSecretName(serviceAccountName), nil
+	}
+
+	return secrets[len(secrets)-1].Name, nil
+}
+
+// getServiceAccountToken reads the token from the service account secret or
+// requests a new bound token, depending on the token mode
+func getServiceAccountToken(ctx context.Context, kubernetes *services.Kubernetes, namespaceName, serviceAccountName string, secret *v1.Secret, tokenMode string, tokenTTL time.Duration) (*serviceAccountToken, error) {
+	if tokenMode == tokenModeTokenRequest {
+		tokenRequest, err := kubernetes.CreateToken(ctx, namespaceName, serviceAccountName, tokenTTL)
+		if err != nil {
+			return nil, fmt.Errorf("error requesting token for service account %s/%s: %w", namespaceName, serviceAccountName, err)
+		}
+
+		expiration := tokenRequest.Status.ExpirationTimestamp.Time
+		logger.Printf("Kubernetes token for service account %s/%s requested, expires at %s\n", namespaceName, serviceAccountName, expiration.Format(time.RFC3339))
+
+		return &serviceAccountToken{
+			token:      tokenRequest.Status.Token,
+			expiration: &expiration,
+		}, nil
+	}
+
+	secret, err := waitSecretToken(ctx, kubernetes, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceAccountToken{
+		token: string(secret.Data["token"]),
+		ca:    secret.Data["ca.crt"],
+	}, nil
+}
+
+// waitSecretToken waits until kubernetes fills the token secret
+func waitSecretToken(ctx context.Context, kubernetes *services.Kubernetes, secret *v1.Secret) (*v1.Secret, error) {
+	namespaceName := secret.Namespace
+	secretName := secret.Name
+
+	// validate the secret fields
+	validatedSecret := false
+	for tries := 0; tries < 5; tries++ {
+		validatedSecret = validateSecretTokenFields(secret)
+		if validatedSecret {
+			break
+		}
+
+		var err error
+		secret, err = kubernetes.GetSecret(ctx, namespaceName, secretName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking for kubernetes secret %s: %w", secretName, err)
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 250):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error waiting for kubernetes secret %s/%s: %w", namespaceName, secretName, ctx.Err())
+		}
+	}
+
+	if !validatedSecret {
+		return nil, fmt.Errorf("error validating secret  %s/%s. It doesn't have token or ca.crt fields", namespaceName, secretName)
+	}
+
+	return secret, nil
+}
+
+func validateSecretTokenFields(secret *v1.Secret) bool {
+	fieldsForValidation := []string{"token", "ca.crt"}
+	for _, field := range fieldsForValidation {
+		if _, ok := secret.Data[field]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serviceConnectionDescription describes the service connection, recording
+// when the token expires. Action is what was done, like Created or Rotated
+func serviceConnectionDescription(action string, token *serviceAccountToken) string {
+	description := fmt.Sprintf("%s by cli azenv at %s", action, time.Now().Local().Format("2 Jan 2006 15:04:05"))
+	if token != nil && token.expiration != nil {
+		description = fmt.Sprintf("%s (%s%s)", description, tokenExpirationMarker, token.expiration.UTC().Format(time.RFC3339))
+	}
+
+	return description
+}
+
+// tokenExpirationFromDescription reads the expiration recorded by
+// serviceConnectionDescription. It is nil when there is none
+func tokenExpirationFromDescription(description string) (*time.Time, error) {
+	index := strings.Index(description, tokenExpirationMarker)
+	if index < 0 {
+		return nil, nil
+	}
+
+	value := description[index+len(tokenExpirationMarker):]
+	if end := strings.IndexAny(value, ") "); end >= 0 {
+		value = value[:end]
+	}
+
+	expiration, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s%s: %w", tokenExpirationMarker, value, err)
+	}
+
+	return &expiration, nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenExpirationFromDescription(t *testing.T) {
+	expiration := time.Date(2027, time.March, 4, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		description string
+		want        *time.Time
+		wantErr     string
+	}{
+		{name: "empty", description: "", want: nil},
+		{name: "no expiration", description: "Created by cli azenv at 4 Mar 2026 10:30:00", want: nil},
+		{name: "created", description: serviceConnectionDescription("Created", &serviceAccountToken{expiration: &expiration}), want: &expiration},
+		{name: "edited after the marker", description: "token-expiration=2027-03-04T10:30:00Z edited by hand", want: &expiration},
+		{name: "last in the description", description: "token-expiration=2027-03-04T10:30:00Z", want: &expiration},
+		{name: "time zone", description: "(token-expiration=2027-03-04T07:30:00-03:00)", want: &expiration},
+		{name: "invalid", description: "(token-expiration=tomorrow)", wantErr: "invalid token-expiration=tomorrow"},
+		{name: "empty value", description: "(token-expiration=)", wantErr: "invalid token-expiration="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := tokenExpirationFromDescription(test.description)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.want == nil {
+				if got != nil {
+					t.Errorf("got expiration %v, want none", got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(*test.want) {
+				t.Errorf("got expiration %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsServiceAccountSecretName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "sa-token", want: true},
+		{name: "sa-token-1700000000", want: true},
+		{name: "sa-tokens", want: false},
+		{name: "sa-other-token", want: false},
+		{name: "sa", want: false},
+		{name: "other-sa-token", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := isServiceAccountSecretName("sa", test.name)
+			if got != test.want {
+				t.Errorf("isServiceAccountSecretName() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
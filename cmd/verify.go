@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "verify",
+	Short:  "Verify an environment",
+	Long:   `Use this command to check that an AzureDevOps Environment still matches the resources created for it`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Println("Error: must also specify a resource like kubernetes")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.PersistentFlags().StringP("project", "p", "", "[required] AzureDevOps project name with organization (ex: myorg/myproject)")
+	err := verifyCmd.MarkPersistentFlagRequired("project")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	verifyCmd.PersistentFlags().StringP("name", "n", "", "[required] AzureDevOps environment name")
+	err = verifyCmd.MarkPersistentFlagRequired("name")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	verifyCmd.PersistentFlags().StringP("service-connection", "c", "", "[required] AzureDevOps service connection name")
+	err = verifyCmd.MarkPersistentFlagRequired("service-connection")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+
+	addOutputFlag(verifyCmd.PersistentFlags())
+	addAzDevOpsFlags(verifyCmd.PersistentFlags())
+}
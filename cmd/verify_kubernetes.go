@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ericogr/azenv/services"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+// verifyKubernetesCmd represents the verify kubernetes command
+var verifyKubernetesCmd = &cobra.Command{
+	PreRun: toggleDebug,
+	Use:    "kubernetes",
+	Short:  "Verify a Kubernetes environment",
+	Long: `Use this command to check that the namespace, service account and token secret of an AzureDevOps Kubernetes Environment
+still exist, that the service connection points to the API server and its token still authenticates (when Azure DevOps returns it)
+and that the environment resource still uses the service connection`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		azDevOpsSettings, err := getAzDevOpsSettings(cmd)
+		if err != nil {
+			return err
+		}
+
+		organizationProject, err := cmd.Flags().GetString("project")
+		if err != nil {
+			return err
+		}
+
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return err
+		}
+
+		serviceConnection, err := cmd.Flags().GetString("service-connection")
+		if err != nil {
+			return err
+		}
+
+		serviceAccount, err := cmd.Flags().GetString("service-account")
+		if err != nil {
+			return err
+		}
+
+		output, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		kubernetes, err := getKubernetes(cmd)
+		if err != nil {
+			return err
+		}
+
+		err = verifyKubernetes(cmd.Context(), azDevOpsSettings, kubernetes, organizationProject, name, serviceAccount, serviceConnection, output)
+		if _, ok := err.(*failedChecksError); ok {
+			cmd.SilenceUsage = true
+		}
+
+		return err
+	},
+}
+
+func init() {
+	verifyCmd.AddCommand(verifyKubernetesCmd)
+
+	verifyKubernetesCmd.Flags().StringP("service-account", "a", "", "[required] Kubernetes service account name with namespace (ex: namespace/service-account-name)")
+	err := verifyKubernetesCmd.MarkFlagRequired("service-account")
+	if err != nil {
+		logger.Println(err.Error())
+	}
+}
+
+const (
+	checkResultPass = "pass"
+	checkResultFail = "fail"
+	checkResultSkip = "skip"
+	// checkResultUnverified is a check that couldn't be done, like reviewing a
+	// token Azure DevOps doesn't return. It doesn't count as a failure
+	checkResultUnverified = "unverified"
+)
+
+// checkResult is the outcome of a single verification
+type checkResult struct {
+	Check   string `json:"check"`
+	Name    string `json:"name"`
+	Result  string `json:"result"`
+	Details string `json:"details,omitempty"`
+}
+
+// verification collects the checks of an environment
+type verification struct {
+	checks []checkResult
+}
+
+func (v *verification) add(check, name, result, details string) {
+	v.checks = append(v.checks, checkResult{
+		Check:   check,
+		Name:    name,
+		Result:  result,
+		Details: details,
+	})
+}
+
+func (v *verification) failures() int {
+	failures := 0
+	for _, check := range v.checks {
+		if check.Result == checkResultFail {
+			failures++
+		}
+	}
+
+	return failures
+}
+
+// failedChecksError is returned when some verification failed
+type failedChecksError struct {
+	failures int
+	checks   int
+}
+
+func (e *failedChecksError) Error() string {
+	return fmt.Sprintf("%d of %d checks failed", e.failures, e.checks)
+}
+
+func verifyKubernetes(ctx context.Context, azDevOpsSettings *azDevOpsSettings, kubernetes *services.Kubernetes, azDevOpsOrgProjectName, environmentName, namespaceServiceAccountName, serviceConnectionName, output string) error {
+	azDevOpsOrganizationName, azDevOpsProjectName, err := splitOrganizationProject(azDevOpsOrgProjectName)
+	if err != nil {
+		return err
+	}
+
+	namespaceName, serviceAccountName, err := splitNamespaceServiceAccount(namespaceServiceAccountName)
+	if err != nil {
+		return err
+	}
+
+	azdevOps := azDevOpsSettings.newAzDevOps(azDevOpsOrganizationName)
+	v := verification{}
+
+	// azure devops
+	// ------------
+	azDevOpsEnvironment, err := azdevOps.FindEnvironment(ctx, azDevOpsProjectName, environmentName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for environment %s: %w", environmentName, err)
+	}
+
+	if azDevOpsEnvironment != nil {
+		v.add("environment", environmentName, checkResultPass, "")
+	} else {
+		v.add("environment", environmentName, checkResultFail, "not found")
+	}
+
+	serviceConnection, err := azdevOps.FindServiceEndpoint(ctx, azDevOpsProjectName, serviceConnectionName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for service connection %s: %w", serviceConnectionName, err)
+	}
+
+	authorizationType := ""
+	if serviceConnection != nil {
+		authorizationType, _ = serviceConnection.Data["authorizationType"].(string)
+		v.add("service connection", serviceConnectionName, checkResultPass, "authorization "+authorizationType)
+	} else {
+		v.add("service connection", serviceConnectionName, checkResultFail, "not found")
+	}
+
+	if azDevOpsEnvironment != nil && serviceConnection != nil {
+		kubernetesResource, err := findEnvironmentResource(ctx, azdevOps, azDevOpsProjectName, azDevOpsEnvironment.Id, namespaceName, serviceConnection)
+		if services.IgnoreResourceNotFoundError(err) != nil {
+			return fmt.Errorf("error looking for resource %s inside environment %s: %w", namespaceName, environmentName, err)
+		}
+
+		if kubernetesResource != nil {
+			v.add("environment resource", namespaceName, checkResultPass, "")
+		} else {
+			v.add("environment resource", namespaceName, checkResultFail, "no resource of the namespace uses service connection "+serviceConnectionName)
+		}
+	} else {
+		v.add("environment resource", namespaceName, checkResultSkip, "environment or service connection not found")
+	}
+
+	// kubernetes
+	// ----------
+	_, err = kubernetes.GetNamespace(ctx, namespaceName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for namespace %s: %w", namespaceName, err)
+	}
+
+	if err == nil {
+		v.add("namespace", namespaceName, checkResultPass, "")
+	} else {
+		v.add("namespace", namespaceName, checkResultFail, "not found")
+	}
+
+	secretName := serviceAccountSecretName(serviceAccountName)
+	if authorizationType == services.AUTHORIZATION_TYPE_AZURE_SUBSCRIPTION {
+		v.add("service account", namespaceName+"/"+serviceAccountName, checkResultSkip, "workload identity federation")
+		v.add("server", serviceConnectionName, checkResultSkip, "workload identity federation")
+		v.add("secret", namespaceName+"/"+secretName, checkResultSkip, "workload identity federation")
+		v.add("token", serviceConnectionName, checkResultSkip, "workload identity federation")
+	} else {
+		err = verifyServiceAccountToken(ctx, kubernetes, &v, namespaceName, serviceAccountName, serviceConnectionName, serviceConnection)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = printOutput(os.Stdout, output, v.checks, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "CHECK\tNAME\tRESULT\tDETAILS")
+		for _, check := range v.checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", check.Check, check.Name, check.Result, check.Details)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if failures := v.failures(); failures > 0 {
+		return &failedChecksError{failures: failures, checks: len(v.checks)}
+	}
+
+	return nil
+}
+
+// verifyServiceAccountToken checks the service account, the API server of the
+// service connection and its token. Azure DevOps usually doesn't return the
+// stored token, so it is only reviewed when it can be read; otherwise the
+// check is unverified and the token secret is reviewed on its own
+func verifyServiceAccountToken(ctx context.Context, kubernetes *services.Kubernetes, v *verification, namespaceName, serviceAccountName, serviceConnectionName string, serviceConnection *services.AzDevopsServiceEndpoint) error {
+	_, err := kubernetes.GetServiceAccount(ctx, namespaceName, serviceAccountName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for service account %s/%s: %w", namespaceName, serviceAccountName, err)
+	}
+
+	if err == nil {
+		v.add("service account", namespaceName+"/"+serviceAccountName, checkResultPass, "")
+	} else {
+		v.add("service account", namespaceName+"/"+serviceAccountName, checkResultFail, "not found")
+	}
+
+	secretName := serviceAccountSecretName(serviceAccountName)
+	if serviceConnection == nil {
+		v.add("server", serviceConnectionName, checkResultSkip, "service connection not found")
+		v.add("secret", namespaceName+"/"+secretName, checkResultSkip, "service connection not found")
+		v.add("token", serviceConnectionName, checkResultSkip, "service connection not found")
+		return nil
+	}
+
+	cluster, err := kubernetes.GetCluster()
+	if err != nil {
+		return fmt.Errorf("error reading kubernetes cluster information: %w", err)
+	}
+
+	if sameServer(serviceConnection.URL, cluster.Server) {
+		v.add("server", serviceConnection.Name, checkResultPass, cluster.Server)
+	} else {
+		v.add("server", serviceConnection.Name, checkResultFail, fmt.Sprintf("service connection uses %s, cluster is %s", serviceConnection.URL, cluster.Server))
+	}
+
+	expiration, err := tokenExpirationFromDescription(serviceConnection.Description)
+	if err != nil {
+		return fmt.Errorf("error reading token expiration of service connection %s: %w", serviceConnection.Name, err)
+	}
+
+	if expiration != nil {
+		v.add("secret", namespaceName+"/"+secretName, checkResultSkip, "token mode is tokenrequest")
+	} else {
+		err = verifyServiceAccountSecret(ctx, kubernetes, v, namespaceName, serviceAccountName)
+		if err != nil {
+			return err
+		}
+	}
+
+	token, err := services.TokenFromAuthorization(serviceConnection.Authorization)
+	if err != nil {
+		v.add("token", serviceConnection.Name, checkResultFail, err.Error())
+		return nil
+	}
+
+	if token == "" {
+		if expiration != nil && time.Now().After(*expiration) {
+			v.add("token", serviceConnection.Name, checkResultFail, "expired at "+expiration.Format(time.RFC3339))
+			return nil
+		}
+
+		details := "the token stored in the service connection can't be read"
+		if expiration != nil {
+			details += ", expires at " + expiration.Format(time.RFC3339)
+		}
+
+		v.add("token", serviceConnection.Name, checkResultUnverified, details)
+		return nil
+	}
+
+	return reviewServiceAccountToken(ctx, kubernetes, v, "token", serviceConnection.Name, namespaceName, serviceAccountName, token)
+}
+
+// verifyServiceAccountSecret checks the current token secret of the service
+// account and reviews its token
+func verifyServiceAccountSecret(ctx context.Context, kubernetes *services.Kubernetes, v *verification, namespaceName, serviceAccountName string) error {
+	// rotate kubernetes replaces the secret by a new one with a suffix
+	secretName, err := currentServiceAccountSecretName(ctx, kubernetes, namespaceName, serviceAccountName)
+	if err != nil {
+		return err
+	}
+
+	secret, err := kubernetes.GetSecret(ctx, namespaceName, secretName)
+	if services.IgnoreResourceNotFoundError(err) != nil {
+		return fmt.Errorf("error looking for secret %s/%s: %w", namespaceName, secretName, err)
+	}
+
+	if secret == nil {
+		v.add("secret", namespaceName+"/"+secretName, checkResultFail, "not found")
+		return nil
+	}
+
+	if secret.Type != v1.SecretTypeServiceAccountToken || secret.Annotations[v1.ServiceAccountNameKey] != serviceAccountName {
+		v.add("secret", namespaceName+"/"+secretName, checkResultFail, "not a token secret of service account "+serviceAccountName)
+		return nil
+	}
+
+	return reviewServiceAccountToken(ctx, kubernetes, v, "secret", namespaceName+"/"+secretName, namespaceName, serviceAccountName, string(secret.Data["token"]))
+}
+
+// reviewServiceAccountToken checks that the token authenticates as the
+// service account
+func reviewServiceAccountToken(ctx context.Context, kubernetes *services.Kubernetes, v *verification, check, name, namespaceName, serviceAccountName, token string) error {
+	tokenReview, err := kubernetes.ReviewToken(ctx, token)
+	if err != nil {
+		return fmt.Errorf("error reviewing token of %s %s: %w", check, name, err)
+	}
+
+	username := fmt.Sprintf("system:serviceaccount:%s:%s", namespaceName, serviceAccountName)
+	if !tokenReview.Status.Authenticated {
+		v.add(check, name, checkResultFail, "token not authenticated "+tokenReview.Status.Error)
+	} else if tokenReview.Status.User.Username != username {
+		v.add(check, name, checkResultFail, "token authenticated as "+tokenReview.Status.User.Username)
+	} else {
+		v.add(check, name, checkResultPass, "token authenticated as "+username)
+	}
+
+	return nil
+}
+
+// sameServer compares API server URLs, ignoring a trailing slash and the case
+func sameServer(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/"))
+}
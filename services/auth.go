@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	AZURE_AD_TOKEN_URL      = "https://login.microsoftonline.com/{tenant}/oauth2/v2.0/token"
+	AZUREDEVOPS_OAUTH_SCOPE = "499b84ac-1321-427f-aa17-267ca6975798/.default"
+)
+
+// Authenticator adds the credentials to every Azure DevOps request
+type Authenticator interface {
+	Authenticate(request *resty.Request) error
+}
+
+// PatAuthenticator uses a Personal Access Token with basic auth
+type PatAuthenticator struct {
+	Pat string
+}
+
+func (a *PatAuthenticator) Authenticate(request *resty.Request) error {
+	request.SetBasicAuth("pat", a.Pat)
+
+	return nil
+}
+
+// BearerTokenAuthenticator uses an already issued access token, like
+// Entra ID tokens from managed identities or System.AccessToken from pipelines
+type BearerTokenAuthenticator struct {
+	Token string
+}
+
+func (a *BearerTokenAuthenticator) Authenticate(request *resty.Request) error {
+	request.SetAuthToken(a.Token)
+
+	return nil
+}
+
+// ClientCredentialsAuthenticator requests access tokens for a service
+// principal using the OAuth2 client credentials flow
+type ClientCredentialsAuthenticator struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	// Client is used to request tokens, usually the one of AzDevOps so the
+	// same retries and timeout apply. A new one is created when nil
+	Client *resty.Client
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (a *ClientCredentialsAuthenticator) Authenticate(request *resty.Request) error {
+	token, err := a.getToken(request.Context())
+	if err != nil {
+		return err
+	}
+
+	request.SetAuthToken(token)
+
+	return nil
+}
+
+// getToken returns the cached token or requests a new one when it's about to expire
+func (a *ClientCredentialsAuthenticator) getToken(ctx context.Context) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.token != "" && time.Now().Add(time.Minute).Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	if a.Client == nil {
+		a.Client = NewClient(RetryOptions{MaxRetries: DEFAULT_MAX_RETRIES, RequestTimeout: DEFAULT_REQUEST_TIMEOUT})
+	}
+
+	scope := a.Scope
+	if scope == "" {
+		scope = AZUREDEVOPS_OAUTH_SCOPE
+	}
+
+	var tokenResponse oauthTokenResponse
+	resp, err := a.Client.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json").
+		SetFormData(map[string]string{
+			"grant_type":    "client_credentials",
+			"client_id":     a.ClientID,
+			"client_secret": a.ClientSecret,
+			"scope":         scope,
+		}).
+		SetResult(&tokenResponse).
+		SetError(&tokenResponse).
+		AddRetryCondition(retryTokenRequest).
+		Post(a.TokenURL)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
+		return "", fmt.Errorf("Error requesting access token: %s %s", resp.Status(), tokenResponse.ErrorDescription)
+	}
+
+	a.token = tokenResponse.AccessToken
+	a.expiresAt = time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+
+	return a.token, nil
+}
+
+// retryTokenRequest also retries network and server errors of the token
+// request, since asking for a token again has no side effect
+func retryTokenRequest(resp *resty.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp != nil && resp.StatusCode() >= http.StatusInternalServerError
+}
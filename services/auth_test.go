@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// testTokenResponse is what the test token server answers to a request
+type testTokenResponse struct {
+	status int
+	body   oauthTokenResponse
+}
+
+// newTestClientCredentialsAuthenticator starts a token server answering the
+// requests with the responses returned by next, counting the requests
+func newTestClientCredentialsAuthenticator(t *testing.T, next func(request int) testTokenResponse) (*ClientCredentialsAuthenticator, *int) {
+	t.Helper()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 10 {
+			t.Errorf("too many token requests")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.Method != http.MethodPost || r.FormValue("grant_type") != "client_credentials" || r.FormValue("client_id") != "client" || r.FormValue("client_secret") != "secret" || r.FormValue("scope") != AZUREDEVOPS_OAUTH_SCOPE {
+			t.Errorf("unexpected token request %s %v", r.Method, r.Form)
+		}
+
+		response := next(requests)
+		status := response.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(response.body)
+	}))
+	t.Cleanup(server.Close)
+
+	authenticator := &ClientCredentialsAuthenticator{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		// no wait between retries to keep the tests fast
+		Client: NewClient(RetryOptions{MaxRetries: 2}).SetRetryWaitTime(time.Millisecond).SetRetryMaxWaitTime(time.Millisecond),
+	}
+
+	return authenticator, &requests
+}
+
+func TestClientCredentialsAuthenticatorCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn int
+		requests  int
+	}{
+		{name: "valid token", expiresIn: 3600, requests: 1},
+		{name: "valid for more than a minute", expiresIn: 120, requests: 1},
+		{name: "expiring within a minute", expiresIn: 60, requests: 2},
+		{name: "expired", expiresIn: 0, requests: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, requests := newTestClientCredentialsAuthenticator(t, func(request int) testTokenResponse {
+				return testTokenResponse{body: oauthTokenResponse{AccessToken: "token" + strings.Repeat("+", request), ExpiresIn: test.expiresIn}}
+			})
+
+			first, err := authenticator.getToken(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			second, err := authenticator.getToken(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *requests != test.requests {
+				t.Fatalf("got %d token requests, want %d", *requests, test.requests)
+			}
+			if want := "token" + strings.Repeat("+", test.requests); second != want {
+				t.Errorf("got token %q, want %q", second, want)
+			}
+			if test.requests == 1 && first != second {
+				t.Errorf("got tokens %q and %q, want the cached one", first, second)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsAuthenticatorError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		requests int
+	}{
+		{name: "bad request", status: http.StatusBadRequest, requests: 1},
+		{name: "unauthorized", status: http.StatusUnauthorized, requests: 1},
+		{name: "server error retried", status: http.StatusInternalServerError, requests: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, requests := newTestClientCredentialsAuthenticator(t, func(request int) testTokenResponse {
+				return testTokenResponse{status: test.status, body: oauthTokenResponse{Error: "invalid_client", ErrorDescription: "AADSTS7000215: Invalid client secret provided"}}
+			})
+
+			token, err := authenticator.getToken(context.Background())
+			if err == nil {
+				t.Fatalf("got token %q, want an error", token)
+			}
+			if !strings.Contains(err.Error(), "AADSTS7000215: Invalid client secret provided") {
+				t.Errorf("got error %q, want the error description", err)
+			}
+			if !strings.Contains(err.Error(), http.StatusText(test.status)) {
+				t.Errorf("got error %q, want the status %d", err, test.status)
+			}
+			if *requests != test.requests {
+				t.Errorf("got %d token requests, want %d", *requests, test.requests)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsAuthenticatorRetry(t *testing.T) {
+	authenticator, requests := newTestClientCredentialsAuthenticator(t, func(request int) testTokenResponse {
+		if request == 1 {
+			return testTokenResponse{status: http.StatusServiceUnavailable}
+		}
+
+		return testTokenResponse{body: oauthTokenResponse{AccessToken: "token", ExpiresIn: 3600}}
+	})
+
+	token, err := authenticator.getToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "token" {
+		t.Errorf("got token %q, want %q", token, "token")
+	}
+	if *requests != 2 {
+		t.Errorf("got %d token requests, want 2", *requests)
+	}
+}
+
+func TestRetryTokenRequest(t *testing.T) {
+	networkError := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name string
+		resp *resty.Response
+		err  error
+		want bool
+	}{
+		{name: "network error", resp: &resty.Response{Request: &resty.Request{Method: http.MethodPost}}, err: networkError, want: true},
+		{name: "ok", resp: newTestResponse(http.MethodPost, http.StatusOK, nil), want: false},
+		{name: "bad request", resp: newTestResponse(http.MethodPost, http.StatusBadRequest, nil), want: false},
+		{name: "unauthorized", resp: newTestResponse(http.MethodPost, http.StatusUnauthorized, nil), want: false},
+		{name: "internal server error", resp: newTestResponse(http.MethodPost, http.StatusInternalServerError, nil), want: true},
+		{name: "bad gateway", resp: newTestResponse(http.MethodPost, http.StatusBadGateway, nil), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := retryTokenRequest(test.resp, test.err)
+			if got != test.want {
+				t.Errorf("retryTokenRequest() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -10,50 +13,115 @@ import (
 type AzDevOps struct {
 	Pat          string
 	Organization string
+	// Authenticator adds credentials to the requests. Pat is used when nil
+	Authenticator Authenticator
+	// BaseURL is the organization (or Azure DevOps Server collection) URL.
+	// {organization} is replaced by Organization. Defaults to https://dev.azure.com/{organization}
+	BaseURL string
+	// IdentityBaseURL is where identities are searched. Defaults to
+	// https://vssps.dev.azure.com/{organization}, or BaseURL when it was changed
+	IdentityBaseURL string
+	// APIVersions overrides the api-version of an API area (see API_AREA_*)
+	APIVersions map[string]string
+	// Client is shared by every request. A new one is created when nil
+	Client *resty.Client
 }
 
-func (az *AzDevOps) CreateEnvironment(project, name string) (*AzDevopsEnvironmentInstance, error) {
-	client := resty.New()
+func (az *AzDevOps) getClient() *resty.Client {
+	if az.Client == nil {
+		az.Client = NewClient(RetryOptions{MaxRetries: DEFAULT_MAX_RETRIES, RequestTimeout: DEFAULT_REQUEST_TIMEOUT})
+	}
+
+	return az.Client
+}
+
+func (az *AzDevOps) apiVersion(area string) string {
+	if version, ok := az.APIVersions[area]; ok {
+		return version
+	}
+
+	return DefaultAPIVersions[area]
+}
+
+// request creates an authenticated request for the API area, canceled with the context
+func (az *AzDevOps) request(ctx context.Context, area string) (*resty.Request, error) {
+	authenticator := az.Authenticator
+	if authenticator == nil {
+		authenticator = &PatAuthenticator{Pat: az.Pat}
+	}
+
+	request := az.getClient().R().
+		SetContext(ctx).
+		SetQueryParam("api-version", az.apiVersion(area))
+	err := authenticator.Authenticate(request)
+	if err != nil {
+		return nil, fmt.Errorf("error authenticating: %w", err)
+	}
+
+	return request, nil
+}
+
+// url joins the base URL with the API path
+func (az *AzDevOps) url(path string) string {
+	baseURL := az.BaseURL
+	if baseURL == "" {
+		baseURL = AZUREDEVOPS_DEFAULT_BASE_URL
+	}
+	baseURL = strings.ReplaceAll(baseURL, "{organization}", url.PathEscape(az.Organization))
+
+	return strings.TrimSuffix(baseURL, "/") + path
+}
+
+// identityURL joins the identity base URL with the API path
+func (az *AzDevOps) identityURL(path string) string {
+	baseURL := az.IdentityBaseURL
+	if baseURL == "" {
+		baseURL = AZUREDEVOPS_DEFAULT_IDENTITY_BASE_URL
+		if az.BaseURL != "" && az.BaseURL != AZUREDEVOPS_DEFAULT_BASE_URL {
+			baseURL = az.BaseURL
+		}
+	}
+	baseURL = strings.ReplaceAll(baseURL, "{organization}", url.PathEscape(az.Organization))
+
+	return strings.TrimSuffix(baseURL, "/") + path
+}
+
+func (az *AzDevOps) CreateEnvironment(ctx context.Context, project, name string) (*AzDevopsEnvironmentInstance, error) {
 	var environmentInstance AzDevopsEnvironmentInstance
-	resp, err := client.R().
-		SetPathParam("organization", az.Organization).
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
 		SetPathParam("project", project).
-		SetBasicAuth("pat", az.Pat).
 		SetHeader("Accept", "application/json").
 		SetBody(map[string]interface{}{"name": name}).
 		SetResult(&environmentInstance).
-		Post(URL_AZUREDEVOPS_ENVIRONMENT)
+		Post(az.url(URL_AZUREDEVOPS_ENVIRONMENT))
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return nil, fmt.Errorf("Error finding environment: %s", resp.Status())
+	err = checkResponse(resp, "creating environment")
+	if err != nil {
+		return nil, err
 	}
 
 	return &environmentInstance, nil
 }
 
-func (az *AzDevOps) FindEnvironment(project, name string) (*AzDevopsEnvironmentInstance, error) {
-	client := resty.New()
-	var environmentInstanceList AzDevopsEnvironmentInstanceList
-	resp, err := client.R().
-		SetPathParam("organization", az.Organization).
-		SetPathParam("project", project).
-		SetBasicAuth("pat", az.Pat).
-		SetQueryParam("name", name).
-		SetHeader("Accept", "application/json").
-		SetResult(&environmentInstanceList).
-		Get(URL_AZUREDEVOPS_ENVIRONMENT)
+func (az *AzDevOps) FindEnvironment(ctx context.Context, project, name string) (*AzDevopsEnvironmentInstance, error) {
+	environments, err := listAll[AzDevopsEnvironmentInstance](ctx, az, API_AREA_ENVIRONMENTS, az.url(URL_AZUREDEVOPS_ENVIRONMENT), pageQueryTop, "finding environment", func(request *resty.Request) {
+		request.
+			SetPathParam("project", project).
+			SetQueryParam("name", name)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return nil, fmt.Errorf("Error finding environment: %s", resp.Status())
-	}
-
-	for _, environment := range environmentInstanceList.Value {
+	for _, environment := range environments {
 		if environment.Name == name {
 			return &environment, nil
 		}
@@ -62,27 +130,56 @@ func (az *AzDevOps) FindEnvironment(project, name string) (*AzDevopsEnvironmentI
 	return nil, &ResourceNotFoundError{resource: "environment"}
 }
 
-func (az *AzDevOps) FindServiceEndpoint(project, name string) (*AzDevopsServiceEndpoint, error) {
-	client := resty.New()
-	var serviceEndpointList AzDevopsServiceEndpointList
-	resp, err := client.R().
-		SetPathParam("organization", az.Organization).
+// ListEnvironments returns every environment of the project
+func (az *AzDevOps) ListEnvironments(ctx context.Context, project string) ([]AzDevopsEnvironmentInstance, error) {
+	return listAll[AzDevopsEnvironmentInstance](ctx, az, API_AREA_ENVIRONMENTS, az.url(URL_AZUREDEVOPS_ENVIRONMENT), pageQueryTop, "listing environments", func(request *resty.Request) {
+		request.SetPathParam("project", project)
+	})
+}
+
+// GetLastDeployment returns the most recent deployment to the environment
+func (az *AzDevOps) GetLastDeployment(ctx context.Context, project string, environmentId int) (*AzDevopsEnvironmentDeploymentRecord, error) {
+	var deploymentRecordList AzDevopsEnvironmentDeploymentRecordList
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
 		SetPathParam("project", project).
-		SetBasicAuth("pat", az.Pat).
-		SetQueryParam("endpointNames", name).
-		SetQueryParam("type", "kubernetes").
+		SetPathParam("environmentId", strconv.Itoa(environmentId)).
+		SetQueryParam("top", "1").
 		SetHeader("Accept", "application/json").
-		SetResult(&serviceEndpointList).
-		Get(URL_AZUREDEVOPS_SERVICE_ENDPOINT_GET)
+		SetResult(&deploymentRecordList).
+		Get(az.url(URL_AZUREDEVOPS_ENVIRONMENT_DEPLOYMENTS))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, "getting environment deployments")
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return nil, fmt.Errorf("Error finding service endpoint: %s", resp.Status())
+	if len(deploymentRecordList.Value) == 0 {
+		return nil, &ResourceNotFoundError{resource: "deployment"}
+	}
+
+	return &deploymentRecordList.Value[0], nil
+}
+
+func (az *AzDevOps) FindServiceEndpoint(ctx context.Context, project, name string) (*AzDevopsServiceEndpoint, error) {
+	serviceEndpoints, err := listAll[AzDevopsServiceEndpoint](ctx, az, API_AREA_SERVICE_ENDPOINTS, az.url(URL_AZUREDEVOPS_SERVICE_ENDPOINT_GET), pageQueryNone, "finding service endpoint", func(request *resty.Request) {
+		request.
+			SetPathParam("project", project).
+			SetQueryParam("endpointNames", name).
+			SetQueryParam("type", "kubernetes")
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for _, serviceEndpoint := range serviceEndpointList.Value {
+	for _, serviceEndpoint := range serviceEndpoints {
 		if serviceEndpoint.Name == name {
 			return &serviceEndpoint, nil
 		}
@@ -91,24 +188,50 @@ func (az *AzDevOps) FindServiceEndpoint(project, name string) (*AzDevopsServiceE
 	return nil, &ResourceNotFoundError{resource: "serviceEndpoint"}
 }
 
-func (az *AzDevOps) FindProject(name string) (*AzDevOpsProject, error) {
-	client := resty.New()
-	var projectList AzDevOpsProjectList
-	resp, err := client.R().
-		SetPathParam("organization", az.Organization).
-		SetBasicAuth("pat", az.Pat).
+// ListServiceEndpoints returns every kubernetes service endpoint of the project
+func (az *AzDevOps) ListServiceEndpoints(ctx context.Context, project string) ([]AzDevopsServiceEndpoint, error) {
+	return listAll[AzDevopsServiceEndpoint](ctx, az, API_AREA_SERVICE_ENDPOINTS, az.url(URL_AZUREDEVOPS_SERVICE_ENDPOINT_GET), pageQueryNone, "listing service endpoints", func(request *resty.Request) {
+		request.
+			SetPathParam("project", project).
+			SetQueryParam("type", "kubernetes")
+	})
+}
+
+// FindProject gets the project by name, falling back to search every page of
+// projects when the server can't get it directly
+func (az *AzDevOps) FindProject(ctx context.Context, name string) (*AzDevOpsProject, error) {
+	var project AzDevOpsProject
+	request, err := az.request(ctx, API_AREA_PROJECTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("projectId", name).
 		SetHeader("Accept", "application/json").
-		SetResult(&projectList).
-		Get(URL_AZUREDEVOPS_PROJECTS)
+		SetResult(&project).
+		Get(az.url(URL_AZUREDEVOPS_PROJECT_ID))
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return nil, fmt.Errorf("Error getting project information: %s", resp.Status())
+	// older servers don't get projects by name, search the list instead. A 404
+	// means the project doesn't exist and is returned as ErrNotFound
+	if resp.StatusCode() != 405 {
+		err = checkResponse(resp, "getting project information")
+		if err != nil {
+			return nil, err
+		}
+
+		return &project, nil
+	}
+
+	projects, err := listAll[AzDevOpsProject](ctx, az, API_AREA_PROJECTS, az.url(URL_AZUREDEVOPS_PROJECTS), pageQueryTopSkip, "getting project information", func(request *resty.Request) {})
+	if err != nil {
+		return nil, err
 	}
 
-	for _, project := range projectList.Value {
+	for _, project := range projects {
 		if project.Name == name {
 			return &project, nil
 		}
@@ -117,24 +240,14 @@ func (az *AzDevOps) FindProject(name string) (*AzDevOpsProject, error) {
 	return nil, &ResourceNotFoundError{resource: "project"}
 }
 
-func (az *AzDevOps) CreateServiceEndpoint(projectId, name, description, kubeconfig string) (*AzDevopsServiceEndpoint, error) {
-	client := resty.New()
+func (az *AzDevOps) CreateServiceEndpoint(ctx context.Context, projectId, name, description string, credentials *KubernetesEndpointCredentials) (*AzDevopsServiceEndpoint, error) {
 	serviceEndpoint := AzDevopsServiceEndpoint{
-		Name: name,
-		URL:  "https://azuredevops.com",
-		Type: "kubernetes",
-		Data: map[string]interface{}{
-			"acceptUntrustedCerts": "true",
-			"authorizationType":    "Kubeconfig",
-		},
-		Description: description,
-		Authorization: AzDevopsServiceEndpointAuthorization{
-			Parameters: AzDevopsServiceEndpointParameters{
-				ClusterContext: KUBERNETES_DEFAULT_CONTEXT_NAME,
-				KubeConfig:     kubeconfig,
-			},
-			Scheme: "Kubernetes",
-		},
+		Name:          name,
+		URL:           credentials.URL,
+		Type:          "kubernetes",
+		Data:          credentials.Data,
+		Description:   description,
+		Authorization: credentials.Authorization,
 		AzServiceEndpointProjectReferences: []AzServiceEndpointProjectReferences{
 			{
 				Description: description,
@@ -146,44 +259,277 @@ func (az *AzDevOps) CreateServiceEndpoint(projectId, name, description, kubeconf
 		},
 		IsShared: false,
 	}
-	resp, err := client.R().
-		SetPathParam("organization", az.Organization).
-		SetBasicAuth("pat", az.Pat).
+
+	request, err := az.request(ctx, API_AREA_SERVICE_ENDPOINTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
 		SetHeader("Accept", "application/json").
 		SetBody(serviceEndpoint).
 		SetResult(&serviceEndpoint).
-		Post(URL_AZUREDEVOPS_SERVICE_ENDPOINT_POST)
+		Post(az.url(URL_AZUREDEVOPS_SERVICE_ENDPOINT_POST))
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return nil, fmt.Errorf("Error creating service endpoint: %s", resp.Status())
+	err = checkResponse(resp, "creating service endpoint")
+	if err != nil {
+		return nil, err
 	}
 
 	return &serviceEndpoint, nil
 }
 
-func (az *AzDevOps) CreateResourceEnvironment(name, projectName, namespace, serviceEndpointId string, environmentId int) error {
-	client := resty.New()
+func (az *AzDevOps) CreateResourceEnvironment(ctx context.Context, name, projectName, namespace, clusterName, serviceEndpointId string, environmentId int) error {
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"name":              name,
+		"namespace":         namespace,
+		"serviceEndpointId": serviceEndpointId,
+	}
+	if clusterName != "" {
+		body["clusterName"] = clusterName
+	}
 
-	resp, err := client.R().
-		SetPathParam("organization", az.Organization).
+	resp, err := request.
 		SetPathParam("project", projectName).
 		SetPathParam("environmentId", strconv.Itoa(environmentId)).
-		SetBasicAuth("pat", az.Pat).
-		SetBody(map[string]interface{}{
-			"name":              name,
-			"namespace":         namespace,
-			"serviceEndpointId": serviceEndpointId,
-		}).
-		Post(URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE)
+		SetBody(body).
+		Post(az.url(URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "creating environment resource")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (az *AzDevOps) GetEnvironment(ctx context.Context, project string, environmentId int) (*AzDevopsEnvironmentInstance, error) {
+	var environmentInstance AzDevopsEnvironmentInstance
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("environmentId", strconv.Itoa(environmentId)).
+		SetQueryParam("expands", "resourceReferences").
+		SetHeader("Accept", "application/json").
+		SetResult(&environmentInstance).
+		Get(az.url(URL_AZUREDEVOPS_ENVIRONMENT_ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() == 404 {
+		return nil, &ResourceNotFoundError{resource: "environment"}
+	}
+
+	err = checkResponse(resp, "getting environment")
+	if err != nil {
+		return nil, err
+	}
+
+	return &environmentInstance, nil
+}
+
+func (az *AzDevOps) DeleteEnvironment(ctx context.Context, project string, environmentId int) error {
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("environmentId", strconv.Itoa(environmentId)).
+		Delete(az.url(URL_AZUREDEVOPS_ENVIRONMENT_ID))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "deleting environment")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (az *AzDevOps) GetKubernetesResource(ctx context.Context, project string, environmentId, resourceId int) (*AzDevopsKubernetesResource, error) {
+	var kubernetesResource AzDevopsKubernetesResource
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("environmentId", strconv.Itoa(environmentId)).
+		SetPathParam("resourceId", strconv.Itoa(resourceId)).
+		SetHeader("Accept", "application/json").
+		SetResult(&kubernetesResource).
+		Get(az.url(URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE_ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() == 404 {
+		return nil, &ResourceNotFoundError{resource: "kubernetesResource"}
+	}
+
+	err = checkResponse(resp, "getting kubernetes resource")
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubernetesResource, nil
+}
+
+// FindKubernetesResource looks for a kubernetes resource registered inside
+// the environment with the specified name
+func (az *AzDevOps) FindKubernetesResource(ctx context.Context, project string, environmentId int, name string) (*AzDevopsKubernetesResource, error) {
+	environment, err := az.GetEnvironment(ctx, project, environmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, resource := range environment.Resources {
+		if strings.EqualFold(resource.Type, AZUREDEVOPS_ENVIRONMENT_RESOURCE_TYPE_KUBERNETES) && resource.Name == name {
+			return az.GetKubernetesResource(ctx, project, environmentId, resource.Id)
+		}
+	}
+
+	return nil, &ResourceNotFoundError{resource: "kubernetesResource"}
+}
+
+// ListKubernetesResources returns the details of every kubernetes resource
+// registered inside the environment
+func (az *AzDevOps) ListKubernetesResources(ctx context.Context, project string, environmentId int) ([]AzDevopsKubernetesResource, error) {
+	environment, err := az.GetEnvironment(ctx, project, environmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	kubernetesResources := []AzDevopsKubernetesResource{}
+	for _, resource := range environment.Resources {
+		if !strings.EqualFold(resource.Type, AZUREDEVOPS_ENVIRONMENT_RESOURCE_TYPE_KUBERNETES) {
+			continue
+		}
+
+		kubernetesResource, err := az.GetKubernetesResource(ctx, project, environmentId, resource.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		kubernetesResources = append(kubernetesResources, *kubernetesResource)
+	}
+
+	return kubernetesResources, nil
+}
+
+func (az *AzDevOps) DeleteKubernetesResource(ctx context.Context, project string, environmentId, resourceId int) error {
+	request, err := az.request(ctx, API_AREA_ENVIRONMENTS)
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("environmentId", strconv.Itoa(environmentId)).
+		SetPathParam("resourceId", strconv.Itoa(resourceId)).
+		Delete(az.url(URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE_ID))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "deleting kubernetes resource")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (az *AzDevOps) UpdateServiceEndpoint(ctx context.Context, serviceEndpoint *AzDevopsServiceEndpoint) (*AzDevopsServiceEndpoint, error) {
+	var updatedServiceEndpoint AzDevopsServiceEndpoint
+	request, err := az.request(ctx, API_AREA_SERVICE_ENDPOINTS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("endpointId", serviceEndpoint.Id).
+		SetHeader("Accept", "application/json").
+		SetBody(serviceEndpoint).
+		SetResult(&updatedServiceEndpoint).
+		Put(az.url(URL_AZUREDEVOPS_SERVICE_ENDPOINT_ID))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, "updating service endpoint")
+	if err != nil {
+		return nil, err
+	}
+
+	return &updatedServiceEndpoint, nil
+}
+
+// ShareServiceEndpoint adds the project references to the service endpoint,
+// so the other projects can use it
+func (az *AzDevOps) ShareServiceEndpoint(ctx context.Context, serviceEndpointId string, references []AzServiceEndpointProjectReferences) error {
+	request, err := az.request(ctx, API_AREA_SERVICE_ENDPOINTS)
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.
+		SetPathParam("endpointId", serviceEndpointId).
+		SetHeader("Accept", "application/json").
+		SetBody(references).
+		Patch(az.url(URL_AZUREDEVOPS_SERVICE_ENDPOINT_ID))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "sharing service endpoint")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteServiceEndpoint removes the service endpoint from the projects. It is
+// only deleted once removed from every project it is shared with
+func (az *AzDevOps) DeleteServiceEndpoint(ctx context.Context, serviceEndpointId string, projectIds []string) error {
+	request, err := az.request(ctx, API_AREA_SERVICE_ENDPOINTS)
 	if err != nil {
 		return err
 	}
 
-	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return fmt.Errorf("Error creating service endpoint: %s. Please check if it's already exists", resp.Status())
+	resp, err := request.
+		SetPathParam("endpointId", serviceEndpointId).
+		SetQueryParam("projectIds", strings.Join(projectIds, ",")).
+		Delete(az.url(URL_AZUREDEVOPS_SERVICE_ENDPOINT_ID))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "deleting service endpoint")
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+// newTestProjectsAzDevOps starts a server answering the get project by name
+// requests with status, and the list requests with the projects
+func newTestProjectsAzDevOps(t *testing.T, status int, projects []AzDevOpsProject) (*AzDevOps, *[]string) {
+	t.Helper()
+
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/organization/_apis/projects" {
+			_ = json.NewEncoder(w).Encode(listPage[AzDevOpsProject]{Count: len(projects), Value: projects})
+			return
+		}
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "failed"})
+			return
+		}
+
+		for _, project := range projects {
+			if project.Name == path.Base(r.URL.Path) {
+				_ = json.NewEncoder(w).Encode(project)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	az := &AzDevOps{
+		Organization: "organization",
+		BaseURL:      server.URL + "/{organization}",
+		Pat:          "pat",
+		Client:       NewClient(RetryOptions{}),
+	}
+
+	return az, &paths
+}
+
+func TestFindProject(t *testing.T) {
+	projects := []AzDevOpsProject{{ID: "1", Name: "other"}, {ID: "2", Name: "project"}}
+
+	tests := []struct {
+		name     string
+		status   int
+		project  string
+		wantId   string
+		wantErr  error
+		requests int
+	}{
+		{name: "found by name", status: http.StatusOK, project: "project", wantId: "2", requests: 1},
+		{name: "not found", status: http.StatusNotFound, project: "project", wantErr: ErrNotFound, requests: 1},
+		{name: "forbidden", status: http.StatusForbidden, project: "project", wantErr: ErrForbidden, requests: 1},
+		{name: "listed", status: http.StatusMethodNotAllowed, project: "project", wantId: "2", requests: 2},
+		{name: "not listed", status: http.StatusMethodNotAllowed, project: "missing", wantErr: ErrNotFound, requests: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			az, paths := newTestProjectsAzDevOps(t, test.status, projects)
+
+			project, err := az.FindProject(context.Background(), test.project)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("got error %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if project.ID != test.wantId {
+				t.Errorf("got project %s, want %s", project.ID, test.wantId)
+			}
+
+			if len(*paths) != test.requests {
+				t.Errorf("got requests %v, want %d", *paths, test.requests)
+			}
+		})
+	}
+}
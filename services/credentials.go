@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubernetesEndpointCredentials is how a kubernetes service connection reaches the cluster
+type KubernetesEndpointCredentials struct {
+	URL           string
+	Data          map[string]interface{}
+	Authorization AzDevopsServiceEndpointAuthorization
+}
+
+// WorkloadIdentityFederation identifies the AKS cluster and the service
+// principal federated with Azure DevOps
+type WorkloadIdentityFederation struct {
+	TenantId           string
+	ServicePrincipalId string
+	SubscriptionName   string
+	// ClusterId is the AKS resource id (/subscriptions/<id>/resourcegroups/<group>/providers/Microsoft.ContainerService/managedClusters/<name>)
+	ClusterId string
+	Namespace string
+}
+
+// NewKubeconfigCredentials authenticates with a kubeconfig of the cluster
+func NewKubeconfigCredentials(cluster *KubernetesCluster, kubeconfig string) *KubernetesEndpointCredentials {
+	return &KubernetesEndpointCredentials{
+		URL: cluster.Server,
+		Data: map[string]interface{}{
+			"acceptUntrustedCerts": strconv.FormatBool(cluster.InsecureSkipTLSVerify),
+			"authorizationType":    AUTHORIZATION_TYPE_KUBECONFIG,
+		},
+		Authorization: AzDevopsServiceEndpointAuthorization{
+			Parameters: AzDevopsServiceEndpointParameters{
+				ClusterContext: KUBERNETES_DEFAULT_CONTEXT_NAME,
+				KubeConfig:     kubeconfig,
+			},
+			Scheme: "Kubernetes",
+		},
+	}
+}
+
+// NewServiceAccountCredentials authenticates with the API server URL, a
+// service account token and the cluster CA
+func NewServiceAccountCredentials(cluster *KubernetesCluster, token string) *KubernetesEndpointCredentials {
+	return &KubernetesEndpointCredentials{
+		URL: cluster.Server,
+		Data: map[string]interface{}{
+			"acceptUntrustedCerts": strconv.FormatBool(cluster.InsecureSkipTLSVerify),
+			"authorizationType":    AUTHORIZATION_TYPE_SERVICE_ACCOUNT,
+		},
+		Authorization: AzDevopsServiceEndpointAuthorization{
+			Parameters: AzDevopsServiceEndpointParameters{
+				ApiToken:                  base64.StdEncoding.EncodeToString([]byte(token)),
+				ServiceAccountCertificate: base64.StdEncoding.EncodeToString(cluster.CertificateAuthorityData),
+				IsCreatedFromSecretYaml:   "false",
+			},
+			Scheme: "Token",
+		},
+	}
+}
+
+// NewWorkloadIdentityCredentials authenticates against an AKS cluster with
+// a service principal using workload identity federation, no token is stored
+func NewWorkloadIdentityCredentials(workloadIdentity WorkloadIdentityFederation) *KubernetesEndpointCredentials {
+	subscriptionId := subscriptionFromResourceId(workloadIdentity.ClusterId)
+	subscriptionName := workloadIdentity.SubscriptionName
+	if subscriptionName == "" {
+		subscriptionName = subscriptionId
+	}
+
+	return &KubernetesEndpointCredentials{
+		URL: "https://management.azure.com/",
+		Data: map[string]interface{}{
+			"authorizationType":     AUTHORIZATION_TYPE_AZURE_SUBSCRIPTION,
+			"azureEnvironment":      "AzureCloud",
+			"azureSubscriptionId":   subscriptionId,
+			"azureSubscriptionName": subscriptionName,
+			"clusterId":             workloadIdentity.ClusterId,
+			"namespace":             workloadIdentity.Namespace,
+			"clusterAdmin":          "false",
+		},
+		Authorization: AzDevopsServiceEndpointAuthorization{
+			Parameters: AzDevopsServiceEndpointParameters{
+				TenantId:           workloadIdentity.TenantId,
+				ServicePrincipalId: workloadIdentity.ServicePrincipalId,
+			},
+			Scheme: "WorkloadIdentityFederation",
+		},
+	}
+}
+
+// subscriptionFromResourceId extracts the subscription id of an Azure resource id
+func subscriptionFromResourceId(resourceId string) string {
+	parts := strings.Split(strings.Trim(resourceId, "/"), "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if strings.EqualFold(parts[i], "subscriptions") {
+			return parts[i+1]
+		}
+	}
+
+	return ""
+}
+
+// TokenFromAuthorization returns the token stored in the authorization of a
+// service connection, from the token scheme or from the kubeconfig. It is
+// empty when Azure DevOps doesn't return it, which is the usual case
+func TokenFromAuthorization(authorization AzDevopsServiceEndpointAuthorization) (string, error) {
+	parameters := authorization.Parameters
+	if parameters.ApiToken != "" {
+		token, err := base64.StdEncoding.DecodeString(parameters.ApiToken)
+		if err != nil {
+			return "", fmt.Errorf("invalid apiToken: %w", err)
+		}
+
+		return string(token), nil
+	}
+
+	if parameters.KubeConfig == "" {
+		return "", nil
+	}
+
+	kubeconfig, err := clientcmd.Load([]byte(parameters.KubeConfig))
+	if err != nil {
+		return "", fmt.Errorf("invalid kubeConfig: %w", err)
+	}
+
+	contextName := parameters.ClusterContext
+	if contextName == "" {
+		contextName = kubeconfig.CurrentContext
+	}
+
+	kubeconfigContext, ok := kubeconfig.Contexts[contextName]
+	if !ok {
+		return "", fmt.Errorf("context %s not found in kubeConfig", contextName)
+	}
+
+	authInfo, ok := kubeconfig.AuthInfos[kubeconfigContext.AuthInfo]
+	if !ok {
+		return "", fmt.Errorf("user %s not found in kubeConfig", kubeconfigContext.AuthInfo)
+	}
+
+	return authInfo.Token, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	// ErrUnauthorized classifies requests without valid credentials (ex: expired PAT)
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden classifies requests the credentials aren't allowed to do (ex: missing PAT scope)
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound classifies requests of resources that don't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict classifies requests conflicting with existing resources (ex: name already in use)
+	ErrConflict = errors.New("conflict")
+)
+
+// AzDevOpsAPIError is a failed Azure DevOps request with the reason sent
+// in the response body. Use errors.Is with ErrUnauthorized, ErrForbidden,
+// ErrNotFound or ErrConflict to classify it
+type AzDevOpsAPIError struct {
+	Operation  string
+	StatusCode int
+	Status     string
+	TypeKey    string
+	Message    string
+	URL        string
+}
+
+func (e *AzDevOpsAPIError) Error() string {
+	message := fmt.Sprintf("Error %s: %s", e.Operation, e.Status)
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+
+	return message
+}
+
+func (e *AzDevOpsAPIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		// an invalid PAT gets a sign-in page with 203 Non-Authoritative Information
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusNonAuthoritativeInfo
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+
+	return false
+}
+
+// azDevOpsErrorBody is the error document returned by Azure DevOps
+type azDevOpsErrorBody struct {
+	Message string `json:"message"`
+	TypeKey string `json:"typeKey"`
+}
+
+// checkResponse returns an AzDevOpsAPIError when the request failed
+func checkResponse(resp *resty.Response, operation string) error {
+	if resp.StatusCode() >= 200 && resp.StatusCode() <= 299 && resp.StatusCode() != http.StatusNonAuthoritativeInfo {
+		return nil
+	}
+
+	apiError := &AzDevOpsAPIError{
+		Operation:  operation,
+		StatusCode: resp.StatusCode(),
+		Status:     resp.Status(),
+		URL:        resp.Request.URL,
+	}
+
+	var body azDevOpsErrorBody
+	if json.Unmarshal(resp.Body(), &body) == nil {
+		apiError.Message = body.Message
+		apiError.TypeKey = body.TypeKey
+	}
+
+	if apiError.Message == "" && resp.StatusCode() == http.StatusNonAuthoritativeInfo {
+		apiError.Message = "the credentials were not accepted, check if the PAT is valid"
+	} else if apiError.Message == "" && strings.HasPrefix(resp.Header().Get("Content-Type"), "text/plain") {
+		apiError.Message = strings.TrimSpace(string(resp.Body()))
+	}
+
+	return apiError
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	sentinels := []error{ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict}
+	jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+	textHeader := http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}}
+
+	tests := []struct {
+		name        string
+		status      int
+		header      http.Header
+		body        string
+		want        error
+		wantMessage string
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "unauthorized", status: http.StatusUnauthorized, want: ErrUnauthorized},
+		{name: "sign-in page", status: http.StatusNonAuthoritativeInfo, header: http.Header{"Content-Type": []string{"text/html"}}, body: "<html></html>", want: ErrUnauthorized, wantMessage: "the credentials were not accepted, check if the PAT is valid"},
+		{name: "forbidden", status: http.StatusForbidden, header: jsonHeader, body: `{"message":"access denied","typeKey":"UnauthorizedRequestException"}`, want: ErrForbidden, wantMessage: "access denied"},
+		{name: "not found", status: http.StatusNotFound, header: jsonHeader, body: `{"message":"project does not exist"}`, want: ErrNotFound, wantMessage: "project does not exist"},
+		{name: "conflict", status: http.StatusConflict, header: textHeader, body: "name already in use\n", want: ErrConflict, wantMessage: "name already in use"},
+		{name: "bad request", status: http.StatusBadRequest, header: jsonHeader, body: `{"message":"invalid"}`, wantMessage: "invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := newTestResponse(http.MethodGet, test.status, test.header).SetBody([]byte(test.body))
+
+			err := checkResponse(resp, "testing")
+			if test.status < 300 && test.status != http.StatusNonAuthoritativeInfo {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				return
+			}
+
+			var apiError *AzDevOpsAPIError
+			if !errors.As(err, &apiError) {
+				t.Fatalf("got error %v, want an AzDevOpsAPIError", err)
+			}
+			if apiError.StatusCode != test.status {
+				t.Errorf("got status %d, want %d", apiError.StatusCode, test.status)
+			}
+			if apiError.Message != test.wantMessage {
+				t.Errorf("got message %q, want %q", apiError.Message, test.wantMessage)
+			}
+
+			// the classification survives wrapping with %w
+			wrapped := fmt.Errorf("error looking for resource: %w", err)
+			for _, sentinel := range sentinels {
+				want := sentinel == test.want
+				if errors.Is(err, sentinel) != want {
+					t.Errorf("errors.Is(err, %v) = %v, want %v", sentinel, !want, want)
+				}
+				if errors.Is(wrapped, sentinel) != want {
+					t.Errorf("errors.Is(wrapped, %v) = %v, want %v", sentinel, !want, want)
+				}
+			}
+		})
+	}
+}
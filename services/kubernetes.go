@@ -5,14 +5,18 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/tools/clientcmd/api/latest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -24,6 +28,28 @@ type Kubernetes struct {
 	Config *rest.Config
 }
 
+// NewKubernetes resolves the kubeconfig file, context and API server once, so
+// every call and the generated kubeconfig use the same cluster. Empty values
+// use the defaults (KUBECONFIG, ~/.kube/config or in-cluster config)
+func NewKubernetes(kubeconfig, context, server string) (*Kubernetes, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: context,
+	}
+	overrides.ClusterInfo.Server = server
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %w", err)
+	}
+
+	return &Kubernetes{
+		Config: config,
+	}, nil
+}
+
 func (k *Kubernetes) getConfig() *rest.Config {
 	if k.Config == nil {
 		return ctrl.GetConfigOrDie()
@@ -93,6 +119,33 @@ func (k *Kubernetes) CreateServiceAccount(ctx context.Context, namespaceName, se
 	return &serviceAccount, nil
 }
 
+// CreateToken issues a bound token for the service account using the TokenRequest API
+func (k *Kubernetes) CreateToken(ctx context.Context, namespace, serviceAccountName string, expiration time.Duration) (*authenticationv1.TokenRequest, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	expirationSeconds := int64(expiration.Seconds())
+	tokenRequest, err := clientset.CoreV1().ServiceAccounts(namespace).
+		CreateToken(
+			ctx,
+			serviceAccountName,
+			&authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{
+					ExpirationSeconds: &expirationSeconds,
+				},
+			},
+			metav1.CreateOptions{},
+		)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &ResourceNotFoundError{resource: "serviceAccount"}
+		}
+
+		return nil, err
+	}
+
+	return tokenRequest, nil
+}
+
 func (k *Kubernetes) GetSecret(ctx context.Context, namespace, secretName string) (*v1.Secret, error) {
 	config := k.getConfig()
 	clientset := kubernetes.NewForConfigOrDie(config)
@@ -109,38 +162,85 @@ func (k *Kubernetes) GetSecret(ctx context.Context, namespace, secretName string
 	return secret, nil
 }
 
-func (k *Kubernetes) CreateKubeconfig(serviceAccountName, namespaceName, token string) (string, error) {
-	var configFlags *genericclioptions.ConfigFlags = genericclioptions.NewConfigFlags(true)
-	kubeConfig := configFlags.ToRawKubeConfigLoader()
-	rawConfig, err := kubeConfig.RawConfig()
+// ListServiceAccountTokenSecrets returns the token secrets of the service account
+func (k *Kubernetes) ListServiceAccountTokenSecrets(ctx context.Context, namespace, serviceAccountName string) ([]v1.Secret, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	secretList, err := clientset.CoreV1().Secrets(namespace).
+		List(ctx, metav1.ListOptions{FieldSelector: "type=" + string(v1.SecretTypeServiceAccountToken)})
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := []v1.Secret{}
+	for _, secret := range secretList.Items {
+		if secret.Annotations[v1.ServiceAccountNameKey] == serviceAccountName {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets, nil
+}
+
+// ReviewToken asks the API server who the token authenticates as
+func (k *Kubernetes) ReviewToken(ctx context.Context, token string) (*authenticationv1.TokenReview, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	tokenReview, err := clientset.AuthenticationV1().TokenReviews().
+		Create(
+			ctx,
+			&authenticationv1.TokenReview{
+				Spec: authenticationv1.TokenReviewSpec{
+					Token: token,
+				},
+			},
+			metav1.CreateOptions{},
+		)
 	if err != nil {
-		return "", fmt.Errorf("failed to get current kubeconfig data")
+		return nil, err
 	}
 
-	ca := []byte(rawConfig.Clusters[rawConfig.Contexts[rawConfig.CurrentContext].Cluster].CertificateAuthorityData)
-	if len(ca) == 0 {
-		caFile := rawConfig.Clusters[rawConfig.Contexts[rawConfig.CurrentContext].Cluster].CertificateAuthority
-		ca, err = os.ReadFile(caFile)
+	return tokenReview, nil
+}
+
+// GetCluster returns the API server and CA of the resolved kubeconfig context
+func (k *Kubernetes) GetCluster() (*KubernetesCluster, error) {
+	config := k.getConfig()
+
+	// the CA must come from the same cluster as the server
+	ca := config.TLSClientConfig.CAData
+	if len(ca) == 0 && config.TLSClientConfig.CAFile != "" {
+		var err error
+		ca, err = os.ReadFile(config.TLSClientConfig.CAFile)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	var currentContext string
-	if *configFlags.Context != "" {
-		currentContext = *configFlags.Context
+	return &KubernetesCluster{
+		Server:                   config.Host,
+		CertificateAuthorityData: ca,
+		InsecureSkipTLSVerify:    config.TLSClientConfig.Insecure,
+	}, nil
+}
+
+// CreateKubeconfig creates a kubeconfig for the service account token. The
+// cluster CA is only left out when TLS verification is skipped
+func (k *Kubernetes) CreateKubeconfig(cluster *KubernetesCluster, serviceAccountName, namespaceName, token string) (string, error) {
+	kubeconfigCluster := &clientcmdapi.Cluster{
+		Server: cluster.Server,
+	}
+
+	if cluster.InsecureSkipTLSVerify {
+		kubeconfigCluster.InsecureSkipTLSVerify = true
 	} else {
-		currentContext = rawConfig.CurrentContext
+		kubeconfigCluster.CertificateAuthorityData = cluster.CertificateAuthorityData
 	}
-	cluster := rawConfig.Contexts[currentContext].Cluster
-	server := rawConfig.Clusters[cluster].Server
+
 	kubeConfigObj := &clientcmdapi.Config{
 		CurrentContext: KUBERNETES_DEFAULT_CONTEXT_NAME,
 		Clusters: map[string]*clientcmdapi.Cluster{
-			KUBERNETES_DEFAULT_CONTEXT_NAME: {
-				Server:                   server,
-				CertificateAuthorityData: ca,
-			},
+			KUBERNETES_DEFAULT_CONTEXT_NAME: kubeconfigCluster,
 		},
 		AuthInfos: map[string]*clientcmdapi.AuthInfo{
 			serviceAccountName: {
@@ -235,3 +335,220 @@ func (k *Kubernetes) UpdateNamespaceLabels(ctx context.Context, namespaceName st
 
 	return nil
 }
+
+func (k *Kubernetes) DeleteSecret(ctx context.Context, namespace, secretName string) error {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	err := clientset.CoreV1().Secrets(namespace).
+		Delete(ctx, secretName, metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &ResourceNotFoundError{resource: "secret"}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (k *Kubernetes) DeleteServiceAccount(ctx context.Context, namespace, serviceAccountName string) error {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	err := clientset.CoreV1().ServiceAccounts(namespace).
+		Delete(ctx, serviceAccountName, metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &ResourceNotFoundError{resource: "serviceAccount"}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (k *Kubernetes) DeleteNamespace(ctx context.Context, namespaceName string) error {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	err := clientset.CoreV1().Namespaces().
+		Delete(ctx, namespaceName, metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &ResourceNotFoundError{resource: "namespace"}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (k *Kubernetes) GetRole(ctx context.Context, namespace, roleName string) (*rbacv1.Role, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	role, err := clientset.RbacV1().Roles(namespace).
+		Get(ctx, roleName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &ResourceNotFoundError{resource: "role"}
+		}
+
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (k *Kubernetes) CreateRole(ctx context.Context, namespace, roleName string, rules []rbacv1.PolicyRule) (*rbacv1.Role, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	role, err := clientset.RbacV1().Roles(namespace).
+		Create(
+			ctx,
+			&rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      roleName,
+					Namespace: namespace,
+				},
+				Rules: rules,
+			},
+			metav1.CreateOptions{},
+		)
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (k *Kubernetes) UpdateRole(ctx context.Context, role *rbacv1.Role) (*rbacv1.Role, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	role, err := clientset.RbacV1().Roles(role.Namespace).
+		Update(ctx, role, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (k *Kubernetes) GetClusterRole(ctx context.Context, clusterRoleName string) (*rbacv1.ClusterRole, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	clusterRole, err := clientset.RbacV1().ClusterRoles().
+		Get(ctx, clusterRoleName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &ResourceNotFoundError{resource: "clusterRole"}
+		}
+
+		return nil, err
+	}
+
+	return clusterRole, nil
+}
+
+func (k *Kubernetes) GetRoleBinding(ctx context.Context, namespace, roleBindingName string) (*rbacv1.RoleBinding, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	roleBinding, err := clientset.RbacV1().RoleBindings(namespace).
+		Get(ctx, roleBindingName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &ResourceNotFoundError{resource: "roleBinding"}
+		}
+
+		return nil, err
+	}
+
+	return roleBinding, nil
+}
+
+// ListRoleBindings returns the role bindings of the namespace
+func (k *Kubernetes) ListRoleBindings(ctx context.Context, namespace string) ([]rbacv1.RoleBinding, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	roleBindingList, err := clientset.RbacV1().RoleBindings(namespace).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBindingList.Items, nil
+}
+
+// CreateRoleBinding binds the role (a Role or ClusterRole) to the service account inside the namespace
+func (k *Kubernetes) CreateRoleBinding(ctx context.Context, namespace, roleBindingName string, roleRef rbacv1.RoleRef, serviceAccountName string) (*rbacv1.RoleBinding, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	roleBinding, err := clientset.RbacV1().RoleBindings(namespace).
+		Create(
+			ctx,
+			&rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      roleBindingName,
+					Namespace: namespace,
+				},
+				RoleRef: roleRef,
+				Subjects: []rbacv1.Subject{
+					{
+						Kind:      rbacv1.ServiceAccountKind,
+						Name:      serviceAccountName,
+						Namespace: namespace,
+					},
+				},
+			},
+			metav1.CreateOptions{},
+		)
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBinding, nil
+}
+
+func (k *Kubernetes) UpdateRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) (*rbacv1.RoleBinding, error) {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	roleBinding, err := clientset.RbacV1().RoleBindings(roleBinding.Namespace).
+		Update(ctx, roleBinding, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBinding, nil
+}
+
+func (k *Kubernetes) DeleteRole(ctx context.Context, namespace, roleName string) error {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	err := clientset.RbacV1().Roles(namespace).
+		Delete(ctx, roleName, metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &ResourceNotFoundError{resource: "role"}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (k *Kubernetes) DeleteRoleBinding(ctx context.Context, namespace, roleBindingName string) error {
+	config := k.getConfig()
+	clientset := kubernetes.NewForConfigOrDie(config)
+	err := clientset.RbacV1().RoleBindings(namespace).
+		Delete(ctx, roleBindingName, metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &ResourceNotFoundError{resource: "roleBinding"}
+		}
+
+		return err
+	}
+
+	return nil
+}
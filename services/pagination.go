@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	HEADER_CONTINUATION_TOKEN = "x-ms-continuationtoken"
+	DEFAULT_PAGE_SIZE         = 100
+)
+
+// pageQuery tells which query parameters a list API accepts to page its
+// results. Empty names mean the API doesn't support them
+type pageQuery struct {
+	top  string
+	skip string
+}
+
+var (
+	// pageQueryNone only follows the continuation token, if any
+	pageQueryNone = pageQuery{}
+	// pageQueryTop asks for pages of DEFAULT_PAGE_SIZE and follows the continuation token
+	pageQueryTop = pageQuery{top: "$top"}
+	// pageQueryTopSkip also uses $skip when no continuation token is returned
+	pageQueryTopSkip = pageQuery{top: "$top", skip: "$skip"}
+)
+
+type listPage[T any] struct {
+	Count int `json:"count"`
+	Value []T `json:"value"`
+}
+
+// listAll requests every page of a list API, following the continuation token
+// (x-ms-continuationtoken header) or $top/$skip until the results are exhausted.
+// prepare sets the path and query parameters of each request
+func listAll[T any](ctx context.Context, az *AzDevOps, area, url string, query pageQuery, operation string, prepare func(*resty.Request)) ([]T, error) {
+	items := []T{}
+	continuationToken := ""
+	skip := 0
+	for {
+		var page listPage[T]
+		request, err := az.request(ctx, area)
+		if err != nil {
+			return nil, err
+		}
+
+		prepare(request)
+		if query.top != "" {
+			request.SetQueryParam(query.top, strconv.Itoa(DEFAULT_PAGE_SIZE))
+		}
+
+		if continuationToken != "" {
+			request.SetQueryParam("continuationToken", continuationToken)
+		} else if query.skip != "" && skip > 0 {
+			request.SetQueryParam(query.skip, strconv.Itoa(skip))
+		}
+
+		resp, err := request.
+			SetHeader("Accept", "application/json").
+			SetResult(&page).
+			Get(url)
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkResponse(resp, operation)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, page.Value...)
+
+		nextToken := resp.Header().Get(HEADER_CONTINUATION_TOKEN)
+		if nextToken != "" {
+			// a repeated token would request the same page forever
+			if nextToken == continuationToken {
+				return items, nil
+			}
+
+			continuationToken = nextToken
+			continue
+		}
+
+		if continuationToken != "" || query.skip == "" || len(page.Value) < DEFAULT_PAGE_SIZE {
+			return items, nil
+		}
+
+		skip += len(page.Value)
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type testItem struct {
+	Id int `json:"id"`
+}
+
+// testPage is what the test server answers to a list request
+type testPage struct {
+	status            int
+	items             []testItem
+	continuationToken string
+	// setToken sends the continuation token header even when it is empty
+	setToken bool
+}
+
+// newTestAzDevOps starts a server answering the list requests with the pages
+// returned by next, recording the query of every request
+func newTestAzDevOps(t *testing.T, next func(query url.Values) testPage) (*AzDevOps, *[]url.Values) {
+	t.Helper()
+
+	queries := []url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		if len(queries) > 10 {
+			t.Errorf("too many requests, listAll is looping")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		page := next(r.URL.Query())
+		if page.continuationToken != "" || page.setToken {
+			w.Header().Set(HEADER_CONTINUATION_TOKEN, page.continuationToken)
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		status := page.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+
+		if status != http.StatusOK {
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "failed"})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(listPage[testItem]{Count: len(page.items), Value: page.items})
+	}))
+	t.Cleanup(server.Close)
+
+	az := &AzDevOps{
+		Organization: "organization",
+		BaseURL:      server.URL,
+		Pat:          "pat",
+		Client:       NewClient(RetryOptions{}),
+	}
+
+	return az, &queries
+}
+
+func testItems(from, to int) []testItem {
+	items := []testItem{}
+	for id := from; id < to; id++ {
+		items = append(items, testItem{Id: id})
+	}
+
+	return items
+}
+
+func listTestItems(az *AzDevOps, query pageQuery) ([]testItem, error) {
+	return listAll[testItem](context.Background(), az, API_AREA_PROJECTS, az.url("/items"), query, "listing items", func(request *resty.Request) {})
+}
+
+func checkItems(t *testing.T, items []testItem, count int) {
+	t.Helper()
+
+	if len(items) != count {
+		t.Fatalf("got %d items, want %d", len(items), count)
+	}
+
+	for i, item := range items {
+		if item.Id != i {
+			t.Fatalf("item %d has id %d, want %d", i, item.Id, i)
+		}
+	}
+}
+
+func TestListAllContinuationToken(t *testing.T) {
+	az, queries := newTestAzDevOps(t, func(query url.Values) testPage {
+		switch query.Get("continuationToken") {
+		case "":
+			return testPage{items: testItems(0, 2), continuationToken: "page2"}
+		case "page2":
+			return testPage{items: testItems(2, 4), continuationToken: "page3"}
+		default:
+			return testPage{items: testItems(4, 5)}
+		}
+	})
+
+	items, err := listTestItems(az, pageQueryNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkItems(t, items, 5)
+	if len(*queries) != 3 {
+		t.Fatalf("got %d requests, want 3", len(*queries))
+	}
+	for _, query := range *queries {
+		if query.Has("$top") || query.Has("$skip") {
+			t.Errorf("unexpected paging parameters in %v", query)
+		}
+	}
+}
+
+func TestListAllRepeatedContinuationToken(t *testing.T) {
+	az, queries := newTestAzDevOps(t, func(query url.Values) testPage {
+		if query.Get("continuationToken") == "" {
+			return testPage{items: testItems(0, 1), continuationToken: "same"}
+		}
+
+		return testPage{items: testItems(1, 2), continuationToken: "same"}
+	})
+
+	items, err := listTestItems(az, pageQueryNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkItems(t, items, 2)
+	if len(*queries) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*queries))
+	}
+}
+
+func TestListAllEmptyContinuationToken(t *testing.T) {
+	az, queries := newTestAzDevOps(t, func(query url.Values) testPage {
+		return testPage{items: testItems(0, 3), setToken: true}
+	})
+
+	items, err := listTestItems(az, pageQueryNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkItems(t, items, 3)
+	if len(*queries) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*queries))
+	}
+}
+
+func TestListAllTop(t *testing.T) {
+	az, queries := newTestAzDevOps(t, func(query url.Values) testPage {
+		switch query.Get("continuationToken") {
+		case "":
+			return testPage{items: testItems(0, DEFAULT_PAGE_SIZE), continuationToken: "page2"}
+		default:
+			// a full page without token is the last one, $top has no $skip
+			return testPage{items: testItems(DEFAULT_PAGE_SIZE, 2*DEFAULT_PAGE_SIZE)}
+		}
+	})
+
+	items, err := listTestItems(az, pageQueryTop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkItems(t, items, 2*DEFAULT_PAGE_SIZE)
+	if len(*queries) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*queries))
+	}
+	for _, query := range *queries {
+		if query.Get("$top") != strconv.Itoa(DEFAULT_PAGE_SIZE) {
+			t.Errorf("got $top %q, want %d", query.Get("$top"), DEFAULT_PAGE_SIZE)
+		}
+		if query.Has("$skip") {
+			t.Errorf("unexpected $skip in %v", query)
+		}
+	}
+}
+
+func TestListAllTopSkip(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		requests int
+	}{
+		{name: "short last page", total: 2*DEFAULT_PAGE_SIZE + 50, requests: 3},
+		{name: "empty last page", total: 2 * DEFAULT_PAGE_SIZE, requests: 3},
+		{name: "single short page", total: 10, requests: 1},
+		{name: "no items", total: 0, requests: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			az, queries := newTestAzDevOps(t, func(query url.Values) testPage {
+				skip, _ := strconv.Atoi(query.Get("$skip"))
+				top, _ := strconv.Atoi(query.Get("$top"))
+				end := min(skip+top, test.total)
+
+				return testPage{items: testItems(min(skip, end), end)}
+			})
+
+			items, err := listTestItems(az, pageQueryTopSkip)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkItems(t, items, test.total)
+			if len(*queries) != test.requests {
+				t.Fatalf("got %d requests, want %d", len(*queries), test.requests)
+			}
+			for i, query := range *queries {
+				want := ""
+				if i > 0 {
+					want = strconv.Itoa(i * DEFAULT_PAGE_SIZE)
+				}
+				if query.Get("$skip") != want {
+					t.Errorf("request %d got $skip %q, want %q", i, query.Get("$skip"), want)
+				}
+			}
+		})
+	}
+}
+
+func TestListAllTopSkipPrefersContinuationToken(t *testing.T) {
+	az, queries := newTestAzDevOps(t, func(query url.Values) testPage {
+		if query.Get("continuationToken") == "" {
+			return testPage{items: testItems(0, DEFAULT_PAGE_SIZE), continuationToken: "page2"}
+		}
+
+		return testPage{items: testItems(DEFAULT_PAGE_SIZE, 2*DEFAULT_PAGE_SIZE)}
+	})
+
+	items, err := listTestItems(az, pageQueryTopSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkItems(t, items, 2*DEFAULT_PAGE_SIZE)
+	if len(*queries) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*queries))
+	}
+	if (*queries)[1].Has("$skip") {
+		t.Errorf("unexpected $skip with a continuation token in %v", (*queries)[1])
+	}
+}
+
+func TestListAllPageError(t *testing.T) {
+	az, _ := newTestAzDevOps(t, func(query url.Values) testPage {
+		if query.Get("continuationToken") == "" {
+			return testPage{items: testItems(0, 1), continuationToken: "page2"}
+		}
+
+		return testPage{status: http.StatusNotFound}
+	})
+
+	items, err := listTestItems(az, pageQueryNone)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+	if items != nil {
+		t.Errorf("got %d items with an error, want none", len(items))
+	}
+}
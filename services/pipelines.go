@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// GetPipelinePermissions returns which pipelines can use the resource
+// (PIPELINE_RESOURCE_TYPE_ENVIRONMENT or PIPELINE_RESOURCE_TYPE_ENDPOINT)
+func (az *AzDevOps) GetPipelinePermissions(ctx context.Context, project, resourceType, resourceId string) (*AzDevopsPipelinePermissions, error) {
+	var permissions AzDevopsPipelinePermissions
+	request, err := az.request(ctx, API_AREA_PIPELINES)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("resourceType", resourceType).
+		SetPathParam("resourceId", resourceId).
+		SetHeader("Accept", "application/json").
+		SetResult(&permissions).
+		Get(az.url(URL_AZUREDEVOPS_PIPELINE_PERMISSIONS))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, "getting pipeline permissions")
+	if err != nil {
+		return nil, err
+	}
+
+	return &permissions, nil
+}
+
+// UpdatePipelinePermissions authorizes (or not) pipelines to use the resource.
+// Pipelines not listed keep their permission
+func (az *AzDevOps) UpdatePipelinePermissions(ctx context.Context, project, resourceType, resourceId string, permissions *AzDevopsPipelinePermissions) error {
+	request, err := az.request(ctx, API_AREA_PIPELINES)
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("resourceType", resourceType).
+		SetPathParam("resourceId", resourceId).
+		SetHeader("Accept", "application/json").
+		SetBody(permissions).
+		Patch(az.url(URL_AZUREDEVOPS_PIPELINE_PERMISSIONS))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "updating pipeline permissions")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListCheckConfigurations returns the checks of the resource with their settings
+func (az *AzDevOps) ListCheckConfigurations(ctx context.Context, project, resourceType, resourceId string) ([]AzDevopsCheckConfiguration, error) {
+	return listAll[AzDevopsCheckConfiguration](ctx, az, API_AREA_PIPELINES, az.url(URL_AZUREDEVOPS_CHECK_CONFIGURATIONS), pageQueryNone, "listing checks", func(request *resty.Request) {
+		request.
+			SetPathParam("project", project).
+			SetQueryParam("resourceType", resourceType).
+			SetQueryParam("resourceId", resourceId).
+			SetQueryParam("$expand", "settings")
+	})
+}
+
+func (az *AzDevOps) CreateCheckConfiguration(ctx context.Context, project string, check *AzDevopsCheckConfiguration) (*AzDevopsCheckConfiguration, error) {
+	var createdCheck AzDevopsCheckConfiguration
+	request, err := az.request(ctx, API_AREA_PIPELINES)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetHeader("Accept", "application/json").
+		SetBody(check).
+		SetResult(&createdCheck).
+		Post(az.url(URL_AZUREDEVOPS_CHECK_CONFIGURATIONS))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, "creating check")
+	if err != nil {
+		return nil, err
+	}
+
+	return &createdCheck, nil
+}
+
+func (az *AzDevOps) UpdateCheckConfiguration(ctx context.Context, project string, check *AzDevopsCheckConfiguration) (*AzDevopsCheckConfiguration, error) {
+	var updatedCheck AzDevopsCheckConfiguration
+	request, err := az.request(ctx, API_AREA_PIPELINES)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := request.
+		SetPathParam("project", project).
+		SetPathParam("checkId", fmt.Sprint(check.Id)).
+		SetHeader("Accept", "application/json").
+		SetBody(check).
+		SetResult(&updatedCheck).
+		Patch(az.url(URL_AZUREDEVOPS_CHECK_CONFIGURATION_ID))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, "updating check")
+	if err != nil {
+		return nil, err
+	}
+
+	return &updatedCheck, nil
+}
+
+// FindIdentity looks for a user or group by its account (ex: user@example.com),
+// group name (ex: [project]\Contributors) or descriptor
+func (az *AzDevOps) FindIdentity(ctx context.Context, account string) (*AzDevopsIdentity, error) {
+	var identityList AzDevopsIdentityList
+	request, err := az.request(ctx, API_AREA_IDENTITIES)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(account, ";") {
+		// identity descriptor (ex: Microsoft.TeamFoundation.Identity;S-1-9-...)
+		request.SetQueryParam("descriptors", account)
+	} else if isSubjectDescriptor(account) {
+		request.SetQueryParam("subjectDescriptors", account)
+	} else {
+		request.
+			SetQueryParam("searchFilter", "General").
+			SetQueryParam("filterValue", account)
+	}
+
+	resp, err := request.
+		SetQueryParam("queryMembership", "None").
+		SetHeader("Accept", "application/json").
+		SetResult(&identityList).
+		Get(az.identityURL(URL_AZUREDEVOPS_IDENTITIES))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, "finding identity")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(identityList.Value) == 0 {
+		return nil, &ResourceNotFoundError{resource: "identity"}
+	}
+
+	if len(identityList.Value) > 1 {
+		names := make([]string, 0, len(identityList.Value))
+		for _, identity := range identityList.Value {
+			names = append(names, identity.ProviderDisplayName)
+		}
+
+		return nil, fmt.Errorf("identity %s is ambiguous: %s", account, strings.Join(names, ", "))
+	}
+
+	return &identityList.Value[0], nil
+}
+
+// isSubjectDescriptor tells if the value is a graph subject descriptor (ex: aad.NzQ..., vssgp.Uy0...)
+func isSubjectDescriptor(value string) bool {
+	for _, prefix := range []string{"aad.", "aadgp.", "msa.", "vssgp.", "svc.", "s2s.", "bnd."} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	DEFAULT_MAX_RETRIES     = 3
+	DEFAULT_REQUEST_TIMEOUT = 60 * time.Second
+	RETRY_WAIT_TIME         = time.Second
+	RETRY_MAX_WAIT_TIME     = 5 * time.Minute
+	HEADER_RETRY_AFTER      = "Retry-After"
+	HEADER_RATELIMIT_RESET  = "X-RateLimit-Reset"
+)
+
+// ThrottledError is returned when Azure DevOps keeps throttling the requests
+// (429, or 503 with Retry-After) after every retry
+type ThrottledError struct {
+	Method     string
+	URL        string
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	message := fmt.Sprintf("request %s %s throttled by Azure DevOps: %s", e.Method, e.URL, e.Status)
+	if e.RetryAfter > 0 {
+		message += fmt.Sprintf(", retry after %s", e.RetryAfter)
+	}
+
+	return message
+}
+
+// RetryOptions configures the client created by NewClient
+type RetryOptions struct {
+	// MaxRetries is how many times a request is retried, 0 disables retries
+	MaxRetries int
+	// RequestTimeout limits each attempt, 0 means no limit
+	RequestTimeout time.Duration
+	// OnRetry is called before waiting for the next attempt
+	OnRetry func(method, url string, attempt int, reason string)
+}
+
+// NewClient creates a client that retries idempotent requests (and throttled
+// ones, which weren't processed) with exponential backoff and jitter, waiting
+// what Retry-After or X-RateLimit-Reset ask for. Throttled responses are
+// returned as ThrottledError
+func NewClient(options RetryOptions) *resty.Client {
+	client := resty.New().
+		SetLogger(&quietLogger{}).
+		SetTimeout(options.RequestTimeout).
+		SetRetryCount(options.MaxRetries).
+		SetRetryWaitTime(RETRY_WAIT_TIME).
+		SetRetryMaxWaitTime(RETRY_MAX_WAIT_TIME).
+		SetRetryAfter(func(client *resty.Client, resp *resty.Response) (time.Duration, error) {
+			return retryAfter(resp), nil
+		}).
+		AddRetryCondition(shouldRetry).
+		OnAfterResponse(func(client *resty.Client, resp *resty.Response) error {
+			if isThrottled(resp) {
+				return &ThrottledError{
+					Method:     resp.Request.Method,
+					URL:        resp.Request.URL,
+					Status:     resp.Status(),
+					RetryAfter: retryAfter(resp),
+				}
+			}
+
+			return nil
+		})
+
+	if options.OnRetry != nil {
+		client.AddRetryHook(func(resp *resty.Response, err error) {
+			if resp == nil || resp.Request == nil {
+				return
+			}
+
+			reason := resp.Status()
+			if resp.RawResponse == nil && err != nil {
+				reason = err.Error()
+			}
+
+			options.OnRetry(resp.Request.Method, resp.Request.URL, resp.Request.Attempt, reason)
+		})
+	}
+
+	return client
+}
+
+// shouldRetry retries network errors and server errors of idempotent requests
+// and every throttled request
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+
+	if isThrottled(resp) {
+		return true
+	}
+
+	if !isIdempotent(resp.Request.Method) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode() == http.StatusBadGateway ||
+		resp.StatusCode() == http.StatusServiceUnavailable ||
+		resp.StatusCode() == http.StatusGatewayTimeout
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+func isThrottled(resp *resty.Response) bool {
+	if resp.RawResponse == nil {
+		return false
+	}
+
+	return resp.StatusCode() == http.StatusTooManyRequests ||
+		(resp.StatusCode() == http.StatusServiceUnavailable && resp.Header().Get(HEADER_RETRY_AFTER) != "")
+}
+
+// retryAfter reads how long the server asked to wait, 0 when it didn't
+func retryAfter(resp *resty.Response) time.Duration {
+	if resp == nil || resp.RawResponse == nil {
+		return 0
+	}
+
+	if value := resp.Header().Get(HEADER_RETRY_AFTER); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+
+		if date, err := http.ParseTime(value); err == nil && time.Until(date) > 0 {
+			return time.Until(date)
+		}
+	}
+
+	// epoch seconds when the rate limit window resets
+	if value := resp.Header().Get(HEADER_RATELIMIT_RESET); value != "" {
+		if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+			if wait := time.Until(time.Unix(reset, 0)); wait > 0 {
+				return wait
+			}
+		}
+	}
+
+	return 0
+}
+
+// quietLogger drops resty logs, the errors are returned to the callers
+type quietLogger struct{}
+
+func (l *quietLogger) Errorf(format string, v ...interface{}) {}
+func (l *quietLogger) Warnf(format string, v ...interface{})  {}
+func (l *quietLogger) Debugf(format string, v ...interface{}) {}
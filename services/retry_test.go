@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func newTestResponse(method string, status int, header http.Header) *resty.Response {
+	// the keys of the literals aren't canonical, like X-RateLimit-Reset
+	canonicalHeader := http.Header{}
+	for key, values := range header {
+		for _, value := range values {
+			canonicalHeader.Add(key, value)
+		}
+	}
+
+	return &resty.Response{
+		Request:     &resty.Request{Method: method},
+		RawResponse: &http.Response{StatusCode: status, Header: canonicalHeader},
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	retryAfterHeader := http.Header{HEADER_RETRY_AFTER: []string{"1"}}
+	networkError := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name string
+		resp *resty.Response
+		err  error
+		want bool
+	}{
+		{name: "no response", resp: nil, want: false},
+		{name: "GET ok", resp: newTestResponse(http.MethodGet, http.StatusOK, nil), want: false},
+		{name: "GET not found", resp: newTestResponse(http.MethodGet, http.StatusNotFound, nil), want: false},
+		{name: "GET internal server error", resp: newTestResponse(http.MethodGet, http.StatusInternalServerError, nil), want: false},
+		{name: "GET bad gateway", resp: newTestResponse(http.MethodGet, http.StatusBadGateway, nil), want: true},
+		{name: "GET service unavailable", resp: newTestResponse(http.MethodGet, http.StatusServiceUnavailable, nil), want: true},
+		{name: "GET gateway timeout", resp: newTestResponse(http.MethodGet, http.StatusGatewayTimeout, nil), want: true},
+		{name: "PUT bad gateway", resp: newTestResponse(http.MethodPut, http.StatusBadGateway, nil), want: true},
+		{name: "DELETE service unavailable", resp: newTestResponse(http.MethodDelete, http.StatusServiceUnavailable, nil), want: true},
+		{name: "POST bad gateway", resp: newTestResponse(http.MethodPost, http.StatusBadGateway, nil), want: false},
+		{name: "PATCH gateway timeout", resp: newTestResponse(http.MethodPatch, http.StatusGatewayTimeout, nil), want: false},
+		{name: "GET too many requests", resp: newTestResponse(http.MethodGet, http.StatusTooManyRequests, nil), want: true},
+		{name: "POST too many requests", resp: newTestResponse(http.MethodPost, http.StatusTooManyRequests, nil), want: true},
+		{name: "POST service unavailable with Retry-After", resp: newTestResponse(http.MethodPost, http.StatusServiceUnavailable, retryAfterHeader), want: true},
+		{name: "GET network error", resp: &resty.Response{Request: &resty.Request{Method: http.MethodGet}}, err: networkError, want: true},
+		{name: "POST network error", resp: &resty.Response{Request: &resty.Request{Method: http.MethodPost}}, err: networkError, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := shouldRetry(test.resp, test.err)
+			if got != test.want {
+				t.Errorf("shouldRetry() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		// want is compared with a margin, since date headers have a second
+		// precision and the time goes on while the test runs
+		want time.Duration
+	}{
+		{name: "no header", header: nil, want: 0},
+		{name: "seconds", header: http.Header{HEADER_RETRY_AFTER: []string{"30"}}, want: 30 * time.Second},
+		{name: "zero seconds", header: http.Header{HEADER_RETRY_AFTER: []string{"0"}}, want: 0},
+		{name: "invalid", header: http.Header{HEADER_RETRY_AFTER: []string{"soon"}}, want: 0},
+		{name: "http date", header: http.Header{HEADER_RETRY_AFTER: []string{now.Add(2 * time.Minute).UTC().Format(http.TimeFormat)}}, want: 2 * time.Minute},
+		{name: "past http date", header: http.Header{HEADER_RETRY_AFTER: []string{now.Add(-time.Minute).UTC().Format(http.TimeFormat)}}, want: 0},
+		{name: "rate limit reset", header: http.Header{HEADER_RATELIMIT_RESET: []string{strconv.FormatInt(now.Add(time.Minute).Unix(), 10)}}, want: time.Minute},
+		{name: "past rate limit reset", header: http.Header{HEADER_RATELIMIT_RESET: []string{strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)}}, want: 0},
+		{
+			name: "Retry-After before rate limit reset",
+			header: http.Header{
+				HEADER_RETRY_AFTER:     []string{"5"},
+				HEADER_RATELIMIT_RESET: []string{strconv.FormatInt(now.Add(time.Minute).Unix(), 10)},
+			},
+			want: 5 * time.Second,
+		},
+		{
+			name: "invalid Retry-After falls back to rate limit reset",
+			header: http.Header{
+				HEADER_RETRY_AFTER:     []string{"soon"},
+				HEADER_RATELIMIT_RESET: []string{strconv.FormatInt(now.Add(time.Minute).Unix(), 10)},
+			},
+			want: time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := retryAfter(newTestResponse(http.MethodGet, http.StatusTooManyRequests, test.header))
+			if got < test.want-2*time.Second || got > test.want {
+				t.Errorf("retryAfter() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterWithoutResponse(t *testing.T) {
+	if got := retryAfter(nil); got != 0 {
+		t.Errorf("retryAfter(nil) = %s, want 0", got)
+	}
+
+	if got := retryAfter(&resty.Response{}); got != 0 {
+		t.Errorf("retryAfter() without raw response = %s, want 0", got)
+	}
+}
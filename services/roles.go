@@ -0,0 +1,88 @@
+package services
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	ROLE_PRESET_NAMESPACE_ADMIN = "namespace-admin"
+	ROLE_PRESET_DEPLOYER        = "deployer"
+	ROLE_PRESET_READ_ONLY       = "read-only"
+	ROLE_PRESET_PREFIX          = "azenv-"
+)
+
+var (
+	allVerbs      = []string{"*"}
+	deployerVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	readOnlyVerbs = []string{"get", "list", "watch"}
+)
+
+// RolePresets are the rule sets of the roles this tool can create inside a namespace
+var RolePresets = map[string][]rbacv1.PolicyRule{
+	ROLE_PRESET_NAMESPACE_ADMIN: {
+		{
+			APIGroups: []string{"*"},
+			Resources: []string{"*"},
+			Verbs:     allVerbs,
+		},
+	},
+	ROLE_PRESET_DEPLOYER: {
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods", "services", "configmaps", "secrets", "serviceaccounts", "persistentvolumeclaims"},
+			Verbs:     deployerVerbs,
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods/log", "events"},
+			Verbs:     readOnlyVerbs,
+		},
+		{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments", "statefulsets", "daemonsets", "replicasets"},
+			Verbs:     deployerVerbs,
+		},
+		{
+			APIGroups: []string{"batch"},
+			Resources: []string{"jobs", "cronjobs"},
+			Verbs:     deployerVerbs,
+		},
+		{
+			APIGroups: []string{"networking.k8s.io"},
+			Resources: []string{"ingresses", "networkpolicies"},
+			Verbs:     deployerVerbs,
+		},
+		{
+			APIGroups: []string{"autoscaling"},
+			Resources: []string{"horizontalpodautoscalers"},
+			Verbs:     deployerVerbs,
+		},
+	},
+	ROLE_PRESET_READ_ONLY: {
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods", "pods/log", "services", "configmaps", "serviceaccounts", "persistentvolumeclaims", "events"},
+			Verbs:     readOnlyVerbs,
+		},
+		{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments", "statefulsets", "daemonsets", "replicasets"},
+			Verbs:     readOnlyVerbs,
+		},
+		{
+			APIGroups: []string{"batch"},
+			Resources: []string{"jobs", "cronjobs"},
+			Verbs:     readOnlyVerbs,
+		},
+		{
+			APIGroups: []string{"networking.k8s.io"},
+			Resources: []string{"ingresses", "networkpolicies"},
+			Verbs:     readOnlyVerbs,
+		},
+		{
+			APIGroups: []string{"autoscaling"},
+			Resources: []string{"horizontalpodautoscalers"},
+			Verbs:     readOnlyVerbs,
+		},
+	},
+}
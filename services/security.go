@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+)
+
+// SecurityRoleResourceId is the resource of an environment or service endpoint
+// role assignment, made of the project id and the resource id
+func SecurityRoleResourceId(projectId, resourceId string) string {
+	return projectId + "_" + resourceId
+}
+
+// ListRoleAssignments returns the roles assigned (or inherited) by the resource
+// (SECURITY_ROLE_SCOPE_ENVIRONMENT or SECURITY_ROLE_SCOPE_SERVICE_ENDPOINT)
+func (az *AzDevOps) ListRoleAssignments(ctx context.Context, scopeId, resourceId string) ([]AzDevopsRoleAssignment, error) {
+	return listAll[AzDevopsRoleAssignment](ctx, az, API_AREA_SECURITY_ROLES, az.url(URL_AZUREDEVOPS_ROLE_ASSIGNMENTS), pageQueryNone, "listing role assignments", func(request *resty.Request) {
+		request.
+			SetPathParam("scopeId", scopeId).
+			SetPathParam("resourceId", resourceId)
+	})
+}
+
+// SetRoleAssignments assigns the roles, other assignments are kept
+func (az *AzDevOps) SetRoleAssignments(ctx context.Context, scopeId, resourceId string, assignments []AzDevopsRoleAssignmentRequest) error {
+	request, err := az.request(ctx, API_AREA_SECURITY_ROLES)
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.
+		SetPathParam("scopeId", scopeId).
+		SetPathParam("resourceId", resourceId).
+		SetHeader("Accept", "application/json").
+		SetBody(assignments).
+		Put(az.url(URL_AZUREDEVOPS_ROLE_ASSIGNMENTS))
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, "setting role assignments")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -1,18 +1,63 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 const (
-	URL_AZUREDEVOPS_ENVIRONMENT           = "https://dev.azure.com/{organization}/{project}/_apis/distributedtask/environments?api-version=6.1-preview.1"
-	URL_AZUREDEVOPS_SERVICE_ENDPOINT_GET  = "https://dev.azure.com/{organization}/{project}/_apis/serviceendpoint/endpoints?api-version=7.1-preview.4"
-	URL_AZUREDEVOPS_SERVICE_ENDPOINT_POST = "https://dev.azure.com/{organization}/_apis/serviceendpoint/endpoints?api-version=7.1-preview.4"
-	URL_AZUREDEVOPS_PROJECTS              = "https://dev.azure.com/{organization}/_apis/projects?api-version=7.1-preview.4"
-	URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE  = "https://dev.azure.com/{organization}/{project}/_apis/distributedtask/environments/{environmentId}/providers/kubernetes?api-version=7.1-preview.1"
-	KUBERNETES_DEFAULT_CONTEXT_NAME       = "default"
+	AZUREDEVOPS_DEFAULT_BASE_URL                     = "https://dev.azure.com/{organization}"
+	URL_AZUREDEVOPS_ENVIRONMENT                      = "/{project}/_apis/distributedtask/environments"
+	URL_AZUREDEVOPS_ENVIRONMENT_ID                   = "/{project}/_apis/distributedtask/environments/{environmentId}"
+	URL_AZUREDEVOPS_SERVICE_ENDPOINT_GET             = "/{project}/_apis/serviceendpoint/endpoints"
+	URL_AZUREDEVOPS_SERVICE_ENDPOINT_POST            = "/_apis/serviceendpoint/endpoints"
+	URL_AZUREDEVOPS_SERVICE_ENDPOINT_ID              = "/_apis/serviceendpoint/endpoints/{endpointId}"
+	URL_AZUREDEVOPS_PROJECTS                         = "/_apis/projects"
+	URL_AZUREDEVOPS_PROJECT_ID                       = "/_apis/projects/{projectId}"
+	URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE             = "/{project}/_apis/distributedtask/environments/{environmentId}/providers/kubernetes"
+	URL_AZUREDEVOPS_ENVIRONMENT_RESOURCE_ID          = "/{project}/_apis/distributedtask/environments/{environmentId}/providers/kubernetes/{resourceId}"
+	URL_AZUREDEVOPS_ENVIRONMENT_DEPLOYMENTS          = "/{project}/_apis/distributedtask/environments/{environmentId}/environmentdeploymentrecords"
+	URL_AZUREDEVOPS_PIPELINE_PERMISSIONS             = "/{project}/_apis/pipelines/pipelinepermissions/{resourceType}/{resourceId}"
+	URL_AZUREDEVOPS_CHECK_CONFIGURATIONS             = "/{project}/_apis/pipelines/checks/configurations"
+	URL_AZUREDEVOPS_CHECK_CONFIGURATION_ID           = "/{project}/_apis/pipelines/checks/configurations/{checkId}"
+	URL_AZUREDEVOPS_IDENTITIES                       = "/_apis/identities"
+	AZUREDEVOPS_DEFAULT_IDENTITY_BASE_URL            = "https://vssps.dev.azure.com/{organization}"
+	URL_AZUREDEVOPS_ROLE_ASSIGNMENTS                 = "/_apis/securityroles/scopes/{scopeId}/roleassignments/resources/{resourceId}"
+	API_AREA_ENVIRONMENTS                            = "environments"
+	API_AREA_SERVICE_ENDPOINTS                       = "serviceendpoints"
+	API_AREA_PROJECTS                                = "projects"
+	API_AREA_PIPELINES                               = "pipelines"
+	API_AREA_IDENTITIES                              = "identities"
+	API_AREA_SECURITY_ROLES                          = "securityroles"
+	SECURITY_ROLE_SCOPE_ENVIRONMENT                  = "distributedtask.environmentreferencerole"
+	SECURITY_ROLE_SCOPE_SERVICE_ENDPOINT             = "distributedtask.serviceendpointrole"
+	SECURITY_ROLE_ADMINISTRATOR                      = "Administrator"
+	SECURITY_ROLE_USER                               = "User"
+	SECURITY_ROLE_READER                             = "Reader"
+	PIPELINE_RESOURCE_TYPE_ENVIRONMENT               = "environment"
+	PIPELINE_RESOURCE_TYPE_ENDPOINT                  = "endpoint"
+	CHECK_TYPE_APPROVAL_ID                           = "8c6f20a7-a545-4486-9777-f762fafe0d4d"
+	CHECK_TYPE_TASK_ID                               = "fe1de3ee-a436-41b4-bb20-f6eb4cb879a7"
+	BUSINESS_HOURS_TASK_ID                           = "445fde2f-6c39-441c-807f-8a59ff2e075f"
+	AZUREDEVOPS_ENVIRONMENT_RESOURCE_TYPE_KUBERNETES = "kubernetes"
+	AUTHORIZATION_TYPE_KUBECONFIG                    = "Kubeconfig"
+	AUTHORIZATION_TYPE_SERVICE_ACCOUNT               = "ServiceAccount"
+	AUTHORIZATION_TYPE_AZURE_SUBSCRIPTION            = "AzureSubscription"
+	KUBERNETES_DEFAULT_CONTEXT_NAME                  = "default"
 )
 
+// DefaultAPIVersions is the api-version used by each API area
+var DefaultAPIVersions = map[string]string{
+	API_AREA_ENVIRONMENTS:      "7.1-preview.1",
+	API_AREA_SERVICE_ENDPOINTS: "7.1-preview.4",
+	API_AREA_PROJECTS:          "7.1-preview.4",
+	API_AREA_PIPELINES:         "7.1-preview.1",
+	API_AREA_IDENTITIES:        "7.1-preview.1",
+	API_AREA_SECURITY_ROLES:    "7.1-preview.1",
+}
+
 type ResourceNotFoundError struct {
 	resource string
 }
@@ -21,10 +66,14 @@ func (e *ResourceNotFoundError) Error() string {
 	return fmt.Sprintf("resource %s not found", e.resource)
 }
 
-func IgnoreResourceNotFoundError(err error) error {
-	_, ok := err.(*ResourceNotFoundError)
+func (e *ResourceNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
 
-	if ok {
+// IgnoreResourceNotFoundError returns nil for any error that means not found,
+// wrapped or not, like a ResourceNotFoundError or an API error with status 404
+func IgnoreResourceNotFoundError(err error) error {
+	if errors.Is(err, ErrNotFound) {
 		return nil
 	}
 
@@ -44,8 +93,23 @@ type AzDevOpsProject struct {
 }
 
 type AzDevopsEnvironmentInstance struct {
+	Id        int                                    `json:"id"`
+	Name      string                                 `json:"name"`
+	Resources []AzDevopsEnvironmentResourceReference `json:"resources,omitempty"`
+}
+
+type AzDevopsEnvironmentResourceReference struct {
 	Id   int    `json:"id"`
 	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type AzDevopsKubernetesResource struct {
+	Id                int    `json:"id"`
+	Name              string `json:"name"`
+	Namespace         string `json:"namespace"`
+	ClusterName       string `json:"clusterName,omitempty"`
+	ServiceEndpointId string `json:"serviceEndpointId"`
 }
 
 type AzDevopsEnvironmentInstanceList struct {
@@ -53,6 +117,98 @@ type AzDevopsEnvironmentInstanceList struct {
 	Value []AzDevopsEnvironmentInstance `json:"value"`
 }
 
+type AzDevopsEnvironmentDeploymentRecord struct {
+	Id         int                       `json:"id"`
+	StageName  string                    `json:"stageName,omitempty"`
+	JobName    string                    `json:"jobName,omitempty"`
+	Result     string                    `json:"result,omitempty"`
+	QueueTime  *time.Time                `json:"queueTime,omitempty"`
+	StartTime  *time.Time                `json:"startTime,omitempty"`
+	FinishTime *time.Time                `json:"finishTime,omitempty"`
+	Definition AzDevopsPipelineReference `json:"definition"`
+	Owner      AzDevopsPipelineReference `json:"owner"`
+}
+
+type AzDevopsPipelineReference struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type AzDevopsEnvironmentDeploymentRecordList struct {
+	Count int                                   `json:"count"`
+	Value []AzDevopsEnvironmentDeploymentRecord `json:"value"`
+}
+
+type AzDevopsPipelinePermissions struct {
+	AllPipelines *AzDevopsPipelinePermission  `json:"allPipelines,omitempty"`
+	Pipelines    []AzDevopsPipelinePermission `json:"pipelines"`
+}
+
+type AzDevopsPipelinePermission struct {
+	Id         int  `json:"id,omitempty"`
+	Authorized bool `json:"authorized"`
+}
+
+type AzDevopsCheckConfiguration struct {
+	Id       int                    `json:"id,omitempty"`
+	Type     AzDevopsCheckType      `json:"type"`
+	Settings map[string]interface{} `json:"settings"`
+	Resource AzDevopsCheckResource  `json:"resource"`
+	Timeout  int                    `json:"timeout,omitempty"`
+}
+
+type AzDevopsCheckType struct {
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type AzDevopsCheckResource struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type AzDevopsCheckConfigurationList struct {
+	Count int                          `json:"count"`
+	Value []AzDevopsCheckConfiguration `json:"value"`
+}
+
+type AzDevopsIdentity struct {
+	Id                  string `json:"id"`
+	ProviderDisplayName string `json:"providerDisplayName"`
+}
+
+type AzDevopsIdentityList struct {
+	Count int                `json:"count"`
+	Value []AzDevopsIdentity `json:"value"`
+}
+
+type AzDevopsRoleAssignment struct {
+	Identity AzDevopsIdentityRef `json:"identity"`
+	Role     AzDevopsRole        `json:"role"`
+	Access   string              `json:"access,omitempty"`
+}
+
+type AzDevopsIdentityRef struct {
+	Id          string `json:"id"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type AzDevopsRole struct {
+	Name string `json:"name"`
+}
+
+type AzDevopsRoleAssignmentList struct {
+	Count int                      `json:"count"`
+	Value []AzDevopsRoleAssignment `json:"value"`
+}
+
+// AzDevopsRoleAssignmentRequest assigns a role to an identity id
+type AzDevopsRoleAssignmentRequest struct {
+	UserId   string `json:"userId"`
+	RoleName string `json:"roleName"`
+}
+
 type AzDevopsServiceEndpoint struct {
 	Id                                 string                               `json:"id,omitempty"`
 	Name                               string                               `json:"name"`
@@ -65,6 +221,24 @@ type AzDevopsServiceEndpoint struct {
 	IsShared                           bool                                 `json:"isShared,omitempty"`
 }
 
+// ProjectIds lists the owner project and every project the service endpoint
+// is shared with
+func (e *AzDevopsServiceEndpoint) ProjectIds(ownerProjectId string) []string {
+	projectIds := []string{ownerProjectId}
+	seen := map[string]bool{strings.ToLower(ownerProjectId): true}
+	for _, reference := range e.AzServiceEndpointProjectReferences {
+		id := reference.AzureDevopsProjectReference.Id
+		if id == "" || seen[strings.ToLower(id)] {
+			continue
+		}
+
+		seen[strings.ToLower(id)] = true
+		projectIds = append(projectIds, id)
+	}
+
+	return projectIds
+}
+
 type AzServiceEndpointProjectReferences struct {
 	Description                 string                   `json:"description,omitempty"`
 	Name                        string                   `json:"name,omitempty"`
@@ -82,11 +256,22 @@ type AzDevopsServiceEndpointAuthorization struct {
 }
 
 type AzDevopsServiceEndpointParameters struct {
-	ClusterContext string `json:"clusterContext"`
-	KubeConfig     string `json:"kubeConfig"`
+	ClusterContext            string `json:"clusterContext,omitempty"`
+	KubeConfig                string `json:"kubeConfig,omitempty"`
+	ApiToken                  string `json:"apiToken,omitempty"`
+	ServiceAccountCertificate string `json:"serviceAccountCertificate,omitempty"`
+	IsCreatedFromSecretYaml   string `json:"isCreatedFromSecretYaml,omitempty"`
+	TenantId                  string `json:"tenantid,omitempty"`
+	ServicePrincipalId        string `json:"serviceprincipalid,omitempty"`
 }
 
 type AzDevopsServiceEndpointList struct {
 	Count int                       `json:"count"`
 	Value []AzDevopsServiceEndpoint `json:"value"`
 }
+
+type KubernetesCluster struct {
+	Server                   string
+	CertificateAuthorityData []byte
+	InsecureSkipTLSVerify    bool
+}